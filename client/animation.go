@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"syscall/js"
+	"time"
+
+	"ichthyo-cup-front/client/projection"
+)
+
+const (
+	buttonZoomStep     = 0.5
+	buttonZoomDuration = 250 * time.Millisecond
+	wheelEase          = 0.2 // fraction of the remaining wheel zoom applied per frame
+)
+
+// FlyTo animates the map to the given center and zoom. Long jumps zoom out
+// in the middle of the flight so the user can follow where the map went.
+// Any running animation is cancelled; dragging or wheeling cancels this one.
+func (m *IchthyoMapView) FlyTo(lat, lng, zoom float64, duration time.Duration) {
+	zoom = m.clampZoom(zoom)
+	m.stopAnimation()
+	if duration <= 0 || !m.isMounted {
+		m.CenterLat, m.CenterLng, m.Zoom = lat, lng, zoom
+		m.DrawMap()
+		return
+	}
+
+	startLat, startLng, startZoom := m.CenterLat, m.CenterLng, m.Zoom
+	x0, y0 := projection.LatLngToWorld(startLat, startLng, 0)
+	x1, y1 := projection.LatLngToWorld(lat, lng, 0)
+
+	// 画面幅の何倍離れているかで、途中のズームアウト量を決める
+	screen := js.Global().Get("innerWidth").Float()
+	dist := math.Hypot(x1-x0, y1-y0) * math.Pow(2, math.Max(startZoom, zoom))
+	bump := 0.0
+	if dist > screen {
+		bump = math.Min(math.Log2(dist/screen), math.Max(startZoom, zoom)-float64(m.Config.MinZoom))
+	}
+
+	m.isFlying = true
+	m.flyZoom = zoom
+	m.animate(duration, func(t float64) {
+		e := easeInOutCubic(t)
+		x := x0 + (x1-x0)*e
+		y := y0 + (y1-y0)*e
+		m.CenterLat, m.CenterLng = projection.WorldToLatLng(x, y, 0)
+		m.Zoom = m.clampZoom(startZoom + (zoom-startZoom)*e - bump*math.Sin(math.Pi*t))
+		if t >= 1 {
+			m.CenterLat, m.CenterLng, m.Zoom = lat, lng, zoom
+			m.isFlying = false
+		}
+	})
+}
+
+// ZoomBy animates the zoom around the current center, continuing from the
+// target of a running zoom so repeated clicks add up.
+func (m *IchthyoMapView) ZoomBy(delta float64) {
+	zoom := m.Zoom
+	if m.isFlying {
+		zoom = m.flyZoom
+	}
+	m.FlyTo(m.CenterLat, m.CenterLng, zoom+delta, buttonZoomDuration)
+}
+
+// animate calls step with t from 0 to 1 on animation frames over duration.
+func (m *IchthyoMapView) animate(duration time.Duration, step func(t float64)) {
+	m.animSeq++
+	seq := m.animSeq
+	start := js.Global().Get("performance").Call("now").Float()
+	total := float64(duration) / float64(time.Millisecond)
+
+	var frame js.Func
+	frame = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if seq != m.animSeq {
+			frame.Release()
+			return nil
+		}
+		t := math.Max((args[0].Float()-start)/total, 0)
+		if t >= 1 {
+			step(1)
+			frame.Release()
+			m.DrawMap()
+			return nil
+		}
+		step(t)
+		m.scheduleDraw()
+		js.Global().Call("requestAnimationFrame", frame)
+		return nil
+	})
+	js.Global().Call("requestAnimationFrame", frame)
+}
+
+// stopAnimation cancels a running fly-to and wheel zoom.
+func (m *IchthyoMapView) stopAnimation() {
+	m.animSeq++
+	m.isFlying = false
+	m.wheelAnimating = false
+}
+
+// zoomWheel adds a wheel step to the target zoom and eases towards it, keeping
+// the point under the cursor fixed.
+func (m *IchthyoMapView) zoomWheel(cursorX, cursorY, delta float64) {
+	if m.isFlying {
+		m.stopAnimation()
+	}
+	if !m.wheelAnimating {
+		m.wheelTargetZoom = m.Zoom
+	}
+	m.wheelTargetZoom = m.clampZoom(m.wheelTargetZoom + delta)
+	m.wheelAnchor = Point{X: int(cursorX), Y: int(cursorY)}
+	if m.wheelAnimating {
+		return
+	}
+	m.wheelAnimating = true
+
+	var frame js.Func
+	frame = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if !m.wheelAnimating {
+			frame.Release()
+			return nil
+		}
+		ax, ay := float64(m.wheelAnchor.X), float64(m.wheelAnchor.Y)
+		lat1, lng1 := m.viewport().ScreenToLatLng(ax, ay)
+
+		diff := m.wheelTargetZoom - m.Zoom
+		if math.Abs(diff) < 0.001 {
+			m.Zoom = m.wheelTargetZoom
+			m.wheelAnimating = false
+		} else {
+			m.Zoom += diff * wheelEase
+		}
+
+		lat2, lng2 := m.viewport().ScreenToLatLng(ax, ay)
+		m.CenterLat += lat1 - lat2
+		m.CenterLng += lng1 - lng2
+
+		if !m.wheelAnimating {
+			frame.Release()
+			m.DrawMap()
+			return nil
+		}
+		m.scheduleDraw()
+		js.Global().Call("requestAnimationFrame", frame)
+		return nil
+	})
+	js.Global().Call("requestAnimationFrame", frame)
+}
+
+func easeInOutCubic(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	return 1 - math.Pow(-2*t+2, 3)/2
+}
+
+func (m *IchthyoMapView) clampZoom(zoom float64) float64 {
+	return math.Min(math.Max(zoom, float64(m.Config.MinZoom)), float64(m.Config.MaxZoom))
+}
@@ -10,21 +10,26 @@ import (
 // App is the main application component, acting as a router.
 type App struct {
 	vecty.Core
-	currentRoute string
-	mapView      *IchthyoMapView
-	uiView       *UIView
+	currentRoute  string
+	mapView       *IchthyoMapView
+	uiView        *UIView
+	minimap       *Minimap
+	notifications *NotificationCenter // toasts shown on every page
 }
 
 // NewApp creates a new App component.
 func NewApp() *App {
-	app := &App{}
+	app := &App{notifications: NewNotificationCenter()}
 	app.mapView = NewIchthyoMapView()
+	app.mapView.Notifications = app.notifications
 	app.uiView = NewUIView(app.mapView)
+	app.minimap = NewMinimap(app.mapView)
 	return app
 }
 
 // Mount handles component mounting and sets up routing.
 func (a *App) Mount() {
+	a.mapView.LoadGameConfig(nil)
 	a.handleRouteChange(js.Undefined(), nil)
 
 	js.Global().Set("onhashchange", js.FuncOf(a.handleRouteChange))
@@ -51,8 +56,11 @@ func (a *App) Render() vecty.ComponentOrHTML {
 				vecty.Text("リダイレクト中..."),
 			),
 		)
+	case "#/paint":
+		// Go版の地図（ミニマップ付き）
+		return elem.Body(a.mapView, a.uiView, a.minimap, a.notifications)
 	case "#/signup":
-		return elem.Body(&SignupPage{})
+		return elem.Body(&SignupPage{Notifications: a.notifications}, a.notifications)
 	case "#/login":
 		fallthrough
 	default:
@@ -60,7 +68,8 @@ func (a *App) Render() vecty.ComponentOrHTML {
 			OnLogin: func() {
 				js.Global().Get("location").Set("href", "/map")
 			},
+			Notifications: a.notifications,
 		}
-		return elem.Body(loginPage)
+		return elem.Body(loginPage, a.notifications)
 	}
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"syscall/js"
+	"time"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const (
+	bookmarksStorageKey  = "ichthyo_bookmarks"
+	bookmarkFlyDuration  = 1500 * time.Millisecond
+	bookmarkTombstoneTTL = 30 * 24 * time.Hour // how long a delete is kept so other devices see it
+)
+
+// Bookmark is a saved map position.
+type Bookmark struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Zoom      float64 `json:"zoom"`
+	UpdatedAt int64   `json:"updated_at"`        // unix ms, the newer copy wins when syncing
+	Deleted   bool    `json:"deleted,omitempty"` // tombstone so deletes sync too
+}
+
+// BookmarksResponse is the structure for GET/PUT /api/bookmarks?user_id=...,
+// both sent with the JWT.
+//
+// GET returns the user's bookmarks, an empty list if they have none. PUT replaces
+// them with the request's list. The client merges before uploading (newer
+// UpdatedAt wins per ID), so the server stores the list as is; deleted bookmarks
+// are sent as tombstones for bookmarkTombstoneTTL and then dropped.
+type BookmarksResponse struct {
+	UserID    string     `json:"user_id"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// BookmarksPanel lists saved places. Bookmarks are kept in localStorage and,
+// when logged in, synced with /api/bookmarks.
+type BookmarksPanel struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	bookmarks []Bookmark
+	loaded    bool
+	synced    bool // the server's bookmarks were merged since Mount; uploads wait for it
+	syncing   bool // the GET of sync is in flight
+	newName   string
+	editingID string
+	editName  string
+	message   string
+}
+
+// NewBookmarksPanel creates a bookmarks panel for mapView.
+func NewBookmarksPanel(mapView *IchthyoMapView) *BookmarksPanel {
+	return &BookmarksPanel{MapView: mapView}
+}
+
+func (b *BookmarksPanel) Mount() {
+	if !b.loaded {
+		b.loaded = true
+		b.bookmarks = b.loadLocal()
+		b.claimGuestBookmarks()
+	}
+	// 他の端末での変更を拾うため、毎回同期する
+	b.synced = false
+	b.sync()
+	vecty.Rerender(b)
+}
+
+// userID returns the logged-in user, or "" for guests.
+func (b *BookmarksPanel) userID() string {
+	if b.MapView.CurrentUserID != "" {
+		return b.MapView.CurrentUserID
+	}
+	return storedUserID()
+}
+
+func (b *BookmarksPanel) storageKey() string {
+	if id := b.userID(); id != "" {
+		return bookmarksStorageKey + "_" + id
+	}
+	return bookmarksStorageKey
+}
+
+func (b *BookmarksPanel) loadLocal() []Bookmark {
+	return loadStoredBookmarks(b.storageKey())
+}
+
+func loadStoredBookmarks(key string) []Bookmark {
+	raw := js.Global().Get("localStorage").Call("getItem", key)
+	if raw.IsNull() || raw.IsUndefined() {
+		return nil
+	}
+	var list []Bookmark
+	if err := json.Unmarshal([]byte(raw.String()), &list); err != nil {
+		fmt.Println("Failed to parse stored bookmarks:", err)
+		return nil
+	}
+	return list
+}
+
+func (b *BookmarksPanel) saveLocal() {
+	b.bookmarks = pruneTombstones(b.bookmarks, b.userID() != "", time.Now())
+	data, err := json.Marshal(b.bookmarks)
+	if err != nil {
+		return
+	}
+	js.Global().Get("localStorage").Call("setItem", b.storageKey(), string(data))
+}
+
+// claimGuestBookmarks moves the bookmarks saved before logging in to the
+// logged-in user's list, so they are synced with the account from now on.
+func (b *BookmarksPanel) claimGuestBookmarks() {
+	if b.userID() == "" {
+		return
+	}
+	guest := loadStoredBookmarks(bookmarksStorageKey)
+	if len(guest) == 0 {
+		return
+	}
+	b.bookmarks = mergeBookmarks(b.bookmarks, guest)
+	b.saveLocal()
+	js.Global().Get("localStorage").Call("removeItem", bookmarksStorageKey)
+}
+
+// sync merges the server's bookmarks into the local ones and uploads the
+// result. Edits made while it is in flight are included in the upload.
+func (b *BookmarksPanel) sync() {
+	userID := b.userID()
+	if userID == "" || b.syncing {
+		return
+	}
+	b.syncing = true
+	endpoint := apiBaseURL + "/api/bookmarks?user_id=" + url.QueryEscape(userID)
+	authorizedRequest("GET", endpoint, nil, func(responseBody string) {
+		b.syncing = false
+		var data BookmarksResponse
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+			fmt.Println("Failed to unmarshal bookmarks:", err)
+			return
+		}
+		b.bookmarks = mergeBookmarks(b.bookmarks, data.Bookmarks)
+		b.synced = true
+		b.message = ""
+		b.saveLocal()
+		b.upload()
+		vecty.Rerender(b)
+	}, func(errText string) {
+		b.syncing = false
+		fmt.Println("Failed to fetch bookmarks:", errText)
+	})
+}
+
+// upload replaces the server's bookmarks with the local ones. It must only
+// run after a successful sync, or it would delete bookmarks made on other
+// devices.
+func (b *BookmarksPanel) upload() {
+	userID := b.userID()
+	if userID == "" {
+		return
+	}
+	body, err := json.Marshal(BookmarksResponse{UserID: userID, Bookmarks: b.bookmarks})
+	if err != nil {
+		return
+	}
+	endpoint := apiBaseURL + "/api/bookmarks?user_id=" + url.QueryEscape(userID)
+	authorizedRequest("PUT", endpoint, body, nil, func(errText string) {
+		b.synced = false // merge again before the next upload
+		b.message = "Bookmarks not synced: " + errText
+		vecty.Rerender(b)
+	})
+}
+
+// mergeBookmarks combines two bookmark lists by ID, keeping the newer copy.
+func mergeBookmarks(local, remote []Bookmark) []Bookmark {
+	byID := make(map[string]Bookmark)
+	for _, list := range [][]Bookmark{local, remote} {
+		for _, bm := range list {
+			if cur, ok := byID[bm.ID]; !ok || bm.UpdatedAt > cur.UpdatedAt {
+				byID[bm.ID] = bm
+			}
+		}
+	}
+	merged := make([]Bookmark, 0, len(byID))
+	for _, bm := range byID {
+		merged = append(merged, bm)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ID < merged[j].ID })
+	return merged
+}
+
+// pruneTombstones drops deleted bookmarks once other devices have had time to
+// see the delete. Guests don't sync, so theirs are dropped right away.
+func pruneTombstones(list []Bookmark, synced bool, now time.Time) []Bookmark {
+	cutoff := now.Add(-bookmarkTombstoneTTL).UnixNano() / int64(time.Millisecond)
+	kept := list[:0]
+	for _, bm := range list {
+		if bm.Deleted && (!synced || bm.UpdatedAt < cutoff) {
+			continue
+		}
+		kept = append(kept, bm)
+	}
+	return kept
+}
+
+// newBookmarkID returns a random ID, so bookmarks made on different devices
+// at the same time don't collide.
+func newBookmarkID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// changed persists the bookmarks after an edit. Until the server's bookmarks
+// have been merged, it syncs instead of uploading, which uploads afterwards.
+func (b *BookmarksPanel) changed() {
+	b.saveLocal()
+	if b.synced {
+		b.upload()
+	} else {
+		b.sync()
+	}
+	vecty.Rerender(b)
+}
+
+func (b *BookmarksPanel) add(name string) {
+	if name == "" {
+		name = fmt.Sprintf("%.4f, %.4f", b.MapView.CenterLat, b.MapView.CenterLng)
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	b.bookmarks = append(b.bookmarks, Bookmark{
+		ID:        newBookmarkID(),
+		Name:      name,
+		Lat:       b.MapView.CenterLat,
+		Lng:       b.MapView.CenterLng,
+		Zoom:      b.MapView.Zoom,
+		UpdatedAt: now,
+	})
+	b.changed()
+}
+
+func (b *BookmarksPanel) update(id string, fn func(*Bookmark)) {
+	for i := range b.bookmarks {
+		if b.bookmarks[i].ID == id {
+			fn(&b.bookmarks[i])
+			b.bookmarks[i].UpdatedAt = time.Now().UnixNano() / int64(time.Millisecond)
+		}
+	}
+	b.changed()
+}
+
+func (b *BookmarksPanel) Render() vecty.ComponentOrHTML {
+	var items vecty.List
+	for _, bm := range b.bookmarks {
+		if bm.Deleted {
+			continue
+		}
+		items = append(items, b.renderBookmark(bm))
+	}
+
+	var message vecty.ComponentOrHTML
+	if b.message != "" {
+		message = elem.Div(vecty.Markup(vecty.Style("color", "#ff8080")), vecty.Text(b.message))
+	}
+
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "60px"), vecty.Style("right", "20px"), vecty.Style("width", "240px"), vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("zIndex", "1001")),
+		elem.Div(vecty.Markup(vecty.Style("fontWeight", "bold")), vecty.Text("Bookmarks")),
+		elem.Form(
+			vecty.Markup(event.Submit(func(e *vecty.Event) {
+				b.add(b.newName)
+				b.newName = ""
+			}).PreventDefault()),
+			elem.Input(vecty.Markup(
+				vecty.Property("type", "text"),
+				vecty.Property("placeholder", "Name this place"),
+				vecty.Property("value", b.newName),
+				event.Input(func(e *vecty.Event) {
+					b.newName = e.Target.Get("value").String()
+				}),
+			)),
+			elem.Button(vecty.Text("Save"), vecty.Markup(vecty.Property("type", "submit"))),
+		),
+		items,
+		message,
+	)
+}
+
+func (b *BookmarksPanel) renderBookmark(bm Bookmark) vecty.ComponentOrHTML {
+	if b.editingID == bm.ID {
+		return elem.Form(
+			vecty.Markup(event.Submit(func(e *vecty.Event) {
+				name := b.editName
+				b.editingID = ""
+				if name == "" {
+					vecty.Rerender(b)
+					return
+				}
+				b.update(bm.ID, func(x *Bookmark) { x.Name = name })
+			}).PreventDefault()),
+			elem.Input(vecty.Markup(
+				vecty.Property("type", "text"),
+				vecty.Property("value", b.editName),
+				event.Input(func(e *vecty.Event) {
+					b.editName = e.Target.Get("value").String()
+				}),
+			)),
+			elem.Button(vecty.Text("OK"), vecty.Markup(vecty.Property("type", "submit"))),
+		)
+	}
+	return elem.Div(
+		elem.Span(
+			vecty.Markup(
+				vecty.Style("cursor", "pointer"),
+				vecty.Attribute("title", fmt.Sprintf("%.4f, %.4f @ %.1f", bm.Lat, bm.Lng, bm.Zoom)),
+				event.Click(func(e *vecty.Event) {
+					b.MapView.FlyTo(bm.Lat, bm.Lng, bm.Zoom, bookmarkFlyDuration)
+				}),
+			),
+			vecty.Text(bm.Name),
+		),
+		elem.Button(vecty.Text("Rename"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			b.editingID = bm.ID
+			b.editName = bm.Name
+			vecty.Rerender(b)
+		}))),
+		elem.Button(vecty.Text("×"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			b.update(bm.ID, func(x *Bookmark) { x.Deleted = true })
+		}))),
+	)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ichthyo-cup-front/client/projection"
+)
+
+// Position formats understood by the coordinate readout and the jump input:
+//
+//	35.676200, 139.650300[, 16]   decimal degrees, optional zoom
+//	35°40'34.3"N 139°39'01.1"E    degrees/minutes/seconds
+//	xn76urx6                      geohash
+//	16/58210/25806/3/7            zoom/tile_x/tile_y/cell_x/cell_y
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+var (
+	decimalPattern  = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)\s*[, ]\s*(-?\d+(?:\.\d+)?)(?:\s*[, @]\s*(\d+(?:\.\d+)?))?$`)
+	dmsPattern      = regexp.MustCompile(`^(\d+)°\s*(\d+)'\s*(\d+(?:\.\d+)?)"?\s*([NS])[\s,]+(\d+)°\s*(\d+)'\s*(\d+(?:\.\d+)?)"?\s*([EW])$`)
+	tileCellPattern = regexp.MustCompile(`^(\d+)/(-?\d+)/(-?\d+)/(\d+)/(\d+)$`)
+	geohashPattern  = regexp.MustCompile(`^[0-9bcdefghjkmnpqrstuvwxyz]{1,12}$`)
+)
+
+// formatDecimal formats a position as decimal degrees.
+func formatDecimal(lat, lng float64) string {
+	return fmt.Sprintf("%.6f, %.6f", lat, lng)
+}
+
+// formatDMS formats a position as degrees, minutes and seconds.
+func formatDMS(lat, lng float64) string {
+	return dmsPart(lat, "N", "S") + " " + dmsPart(lng, "E", "W")
+}
+
+func dmsPart(v float64, pos, neg string) string {
+	hemi := pos
+	if v < 0 {
+		hemi = neg
+		v = -v
+	}
+	deg := math.Floor(v)
+	min := math.Floor((v - deg) * 60)
+	sec := ((v-deg)*60 - min) * 60
+	if sec >= 59.95 { // 丸めで60.0"にならないように
+		sec = 0
+		min++
+	}
+	if min >= 60 {
+		min = 0
+		deg++
+	}
+	return fmt.Sprintf("%.0f°%02.0f'%04.1f\"%s", deg, min, sec, hemi)
+}
+
+// formatTileCell formats a cell as zoom/tile_x/tile_y/cell_x/cell_y.
+func formatTileCell(c cellRef) string {
+	return fmt.Sprintf("%d/%d/%d/%d/%d", c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY)
+}
+
+// encodeGeohash encodes a position as a geohash of the given length.
+func encodeGeohash(lat, lng float64, precision int) string {
+	latMin, latMax := -90.0, 90.0
+	lngMin, lngMax := -180.0, 180.0
+	var sb strings.Builder
+	bit, ch, even := 0, 0, true
+	for sb.Len() < precision {
+		if even {
+			mid := (lngMin + lngMax) / 2
+			if lng >= mid {
+				ch |= 1 << uint(4-bit)
+				lngMin = mid
+			} else {
+				lngMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if lat >= mid {
+				ch |= 1 << uint(4-bit)
+				latMin = mid
+			} else {
+				latMax = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			sb.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// decodeGeohash returns the center of a geohash cell.
+func decodeGeohash(hash string) (lat, lng float64, err error) {
+	latMin, latMax := -90.0, 90.0
+	lngMin, lngMax := -180.0, 180.0
+	even := true
+	for _, r := range strings.ToLower(hash) {
+		idx := strings.IndexRune(geohashAlphabet, r)
+		if idx < 0 {
+			return 0, 0, fmt.Errorf("invalid geohash character %q", r)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			on := idx&(1<<uint(bit)) != 0
+			if even {
+				mid := (lngMin + lngMax) / 2
+				if on {
+					lngMin = mid
+				} else {
+					lngMax = mid
+				}
+			} else {
+				mid := (latMin + latMax) / 2
+				if on {
+					latMin = mid
+				} else {
+					latMax = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return (latMin + latMax) / 2, (lngMin + lngMax) / 2, nil
+}
+
+// cellCenterLatLng returns the lat/lng at the center of a cell.
+func (m *IchthyoMapView) cellCenterLatLng(c cellRef) (float64, float64) {
+	cellPixelSize := float64(tileSize) / float64(m.Config.GridSize)
+	x := float64(c.TileX*tileSize) + (float64(c.CellX)+0.5)*cellPixelSize
+	y := float64(c.TileY*tileSize) + (float64(c.CellY)+0.5)*cellPixelSize
+	return projection.WorldToLatLng(x, y, float64(c.Zoom))
+}
+
+// parsePosition parses any of the position formats. zoom is 0 when the text
+// doesn't carry one.
+func (m *IchthyoMapView) parsePosition(text string) (lat, lng, zoom float64, err error) {
+	text = strings.TrimSpace(text)
+
+	if tileCellPattern.MatchString(text) {
+		c, err := m.parseTileCell(text)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		lat, lng = m.cellCenterLatLng(c)
+		return lat, lng, float64(c.Zoom), nil
+	}
+
+	if match := decimalPattern.FindStringSubmatch(text); match != nil {
+		lat, _ = strconv.ParseFloat(match[1], 64)
+		lng, _ = strconv.ParseFloat(match[2], 64)
+		if match[3] != "" {
+			zoom, _ = strconv.ParseFloat(match[3], 64)
+		}
+		return checkLatLng(lat, lng, zoom)
+	}
+
+	if match := dmsPattern.FindStringSubmatch(strings.ToUpper(text)); match != nil {
+		lat = dmsValue(match[1], match[2], match[3])
+		if match[4] == "S" {
+			lat = -lat
+		}
+		lng = dmsValue(match[5], match[6], match[7])
+		if match[8] == "W" {
+			lng = -lng
+		}
+		return checkLatLng(lat, lng, 0)
+	}
+
+	if geohashPattern.MatchString(strings.ToLower(text)) {
+		lat, lng, err = decodeGeohash(text)
+		return lat, lng, 0, err
+	}
+
+	return 0, 0, 0, fmt.Errorf("unrecognized position: %s", text)
+}
+
+// parseTileCell parses the zoom/tile_x/tile_y/cell_x/cell_y format.
+func (m *IchthyoMapView) parseTileCell(text string) (cellRef, error) {
+	match := tileCellPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return cellRef{}, fmt.Errorf("expected zoom/tile_x/tile_y/cell_x/cell_y: %s", text)
+	}
+	var c cellRef
+	c.Zoom, _ = strconv.Atoi(match[1])
+	c.TileX, _ = strconv.Atoi(match[2])
+	c.TileY, _ = strconv.Atoi(match[3])
+	c.CellX, _ = strconv.Atoi(match[4])
+	c.CellY, _ = strconv.Atoi(match[5])
+	if c.Zoom < m.Config.MinZoom || c.Zoom > m.Config.MaxZoom || !c.Tile().Valid() || c.CellX >= m.Config.GridSize || c.CellY >= m.Config.GridSize {
+		return cellRef{}, fmt.Errorf("tile/cell position out of range: %s", text)
+	}
+	return c, nil
+}
+
+func dmsValue(deg, min, sec string) float64 {
+	d, _ := strconv.ParseFloat(deg, 64)
+	m, _ := strconv.ParseFloat(min, 64)
+	s, _ := strconv.ParseFloat(sec, 64)
+	return d + m/60 + s/3600
+}
+
+func checkLatLng(lat, lng, zoom float64) (float64, float64, float64, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, 0, fmt.Errorf("position out of range: %.6f, %.6f", lat, lng)
+	}
+	return lat, lng, zoom, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"syscall/js"
+	"time"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+const (
+	draftStorageKey = "ichthyo_draft"
+	draftSaveDelay  = 500 // ms after the last edit
+)
+
+// DraftCell is one cell of a saved selection.
+type DraftCell struct {
+	TileX int    `json:"tile_x"`
+	TileY int    `json:"tile_y"`
+	CellX int    `json:"cell_x"`
+	CellY int    `json:"cell_y"`
+	Color string `json:"color"`
+	Under string `json:"under,omitempty"` // painted color when the draft was saved
+}
+
+// SelectionDraft is the unsent selection kept in localStorage across reloads.
+type SelectionDraft struct {
+	GridSize  int         `json:"grid_size"`  // cell grid the cells are on, see onGrid
+	PaintZoom int         `json:"paint_zoom"` // zoom of that grid
+	Zoom      int         `json:"zoom"`       // view zoom when saved
+	Color     string      `json:"color"`      // selected paint color
+	CenterLat float64     `json:"center_lat"`
+	CenterLng float64     `json:"center_lng"`
+	SavedAt   string      `json:"saved_at"`
+	Cells     []DraftCell `json:"cells"`
+}
+
+func (m *IchthyoMapView) draftStorageKey() string {
+	id := m.CurrentUserID
+	if id == "" {
+		id = storedUserID()
+	}
+	if id != "" {
+		return draftStorageKey + "_" + id
+	}
+	return draftStorageKey
+}
+
+// scheduleDraftSave saves the selection shortly after the last edit, so a
+// brush stroke isn't written on every cell.
+func (m *IchthyoMapView) scheduleDraftSave() {
+	if m.draftSaveScheduled {
+		return
+	}
+	m.draftSaveScheduled = true
+	var save js.Func
+	save = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		save.Release()
+		m.draftSaveScheduled = false
+		m.saveDraft()
+		return nil
+	})
+	js.Global().Call("setTimeout", save, draftSaveDelay)
+}
+
+// saveDraft writes the selection to localStorage, or removes the draft when
+// nothing is selected. A draft waiting to be restored is left alone.
+func (m *IchthyoMapView) saveDraft() {
+	if m.pendingDraft != nil {
+		return
+	}
+	storage := js.Global().Get("localStorage")
+	if len(m.SelectedCells) == 0 {
+		storage.Call("removeItem", m.draftStorageKey())
+		return
+	}
+
+	draft := SelectionDraft{
+		GridSize:  m.Config.GridSize,
+		PaintZoom: m.Config.PaintZoom,
+		Zoom:      int(math.Ceil(m.Zoom)),
+		Color:     m.SelectedColor,
+		CenterLat: m.CenterLat,
+		CenterLng: m.CenterLng,
+		SavedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	for c, sel := range m.SelectedCells {
+		under, _ := m.paintedColor(c)
+		draft.Cells = append(draft.Cells, DraftCell{
+			TileX: c.TileX,
+			TileY: c.TileY,
+			CellX: c.CellX,
+			CellY: c.CellY,
+			Color: sel.Payload.Color,
+			Under: under,
+		})
+	}
+	data, err := json.Marshal(draft)
+	if err != nil {
+		return
+	}
+	storage.Call("setItem", m.draftStorageKey(), string(data))
+}
+
+func (m *IchthyoMapView) loadDraft() *SelectionDraft {
+	raw := js.Global().Get("localStorage").Call("getItem", m.draftStorageKey())
+	if raw.IsNull() || raw.IsUndefined() {
+		return nil
+	}
+	var draft SelectionDraft
+	if err := json.Unmarshal([]byte(raw.String()), &draft); err != nil {
+		fmt.Println("Failed to parse saved selection:", err)
+		return nil
+	}
+	if len(draft.Cells) == 0 {
+		return nil
+	}
+	return &draft
+}
+
+// onGrid reports whether the draft was saved on config's cell grid.
+func (d *SelectionDraft) onGrid(config GameConfig) bool {
+	return d.GridSize == config.GridSize && d.PaintZoom == config.PaintZoom
+}
+
+// checkDraftWhenReady runs checkDraft once the game config has loaded, or
+// failed to, since the draft is on the server's grid.
+func (m *IchthyoMapView) checkDraftWhenReady() {
+	if !m.configLoaded {
+		m.draftCheckPending = true
+		return
+	}
+	if len(m.SelectedCells) == 0 {
+		m.checkDraft()
+	}
+}
+
+// checkDraft loads the saved selection on mount. It is restored right away if
+// the paint under it is unchanged; otherwise it waits for RestoreDraft or
+// DiscardDraft, see PendingDraft.
+func (m *IchthyoMapView) checkDraft() {
+	draft := m.loadDraft()
+	if draft == nil {
+		return
+	}
+	if !draft.onGrid(m.Config) {
+		// 別のグリッドのセルは復元できない
+		fmt.Println("Discarding the saved selection, it is on a different cell grid")
+		js.Global().Get("localStorage").Call("removeItem", m.draftStorageKey())
+		return
+	}
+	m.pendingDraft = draft
+
+	tiles := make(map[geometry.TileCoord]bool)
+	for _, c := range draft.Cells {
+		tiles[draft.cell(c).Tile().Wrap()] = true
+	}
+	remaining := len(tiles)
+	done := func() {
+		remaining--
+		if remaining > 0 {
+			return
+		}
+		m.draftChanged = m.changedUnderDraft(draft)
+		if m.draftChanged == 0 {
+			m.RestoreDraft()
+			return
+		}
+		if m.OnSelectionChange != nil {
+			m.OnSelectionChange()
+		}
+	}
+	for t := range tiles {
+		m.whenPaintLoaded(t, done)
+	}
+}
+
+// changedUnderDraft counts draft cells whose paint differs from when it was
+// saved. Tiles that couldn't be loaded count as changed.
+func (m *IchthyoMapView) changedUnderDraft(draft *SelectionDraft) int {
+	changed := 0
+	for _, c := range draft.Cells {
+		painted, loaded := m.paintedColor(draft.cell(c))
+		if !loaded || painted != c.Under {
+			changed++
+		}
+	}
+	return changed
+}
+
+func (d *SelectionDraft) cell(c DraftCell) cellRef {
+	return cellRef{Zoom: d.PaintZoom, TileX: c.TileX, TileY: c.TileY, CellX: c.CellX, CellY: c.CellY}
+}
+
+// PendingDraft returns the saved selection waiting to be restored and how
+// many of its cells were painted over since it was saved.
+func (m *IchthyoMapView) PendingDraft() (draft *SelectionDraft, changed int) {
+	return m.pendingDraft, m.draftChanged
+}
+
+// RestoreDraft adds the saved selection to the current one.
+func (m *IchthyoMapView) RestoreDraft() {
+	draft := m.pendingDraft
+	if draft == nil {
+		return
+	}
+	m.pendingDraft = nil
+	if draft.Color != "" {
+		m.SetSelectedColor(draft.Color)
+	}
+
+	var cells []cellRef
+	var colors []string
+	for _, c := range draft.Cells {
+		color, err := m.ValidateColor(c.Color)
+		if err != nil {
+			continue
+		}
+		cells = append(cells, draft.cell(c))
+		colors = append(colors, color)
+	}
+	m.selectColoredCells("Restore draft", cells, colors)
+}
+
+// DiscardDraft forgets the saved selection.
+func (m *IchthyoMapView) DiscardDraft() {
+	m.pendingDraft = nil
+	m.saveDraft()
+	if m.OnSelectionChange != nil {
+		m.OnSelectionChange()
+	}
+}
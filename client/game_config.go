@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+// Defaults of the game rules, used until the server's game config is loaded
+// and for anything it leaves out.
+const (
+	defaultMinZoom      = 1
+	defaultMaxZoom      = 18
+	defaultCellGridSize = 16
+	defaultPaintZoom    = 15
+	defaultInkCost      = 1 // ink per cell
+)
+
+// GameConfig is the game rules the map follows, see LoadGameConfig.
+type GameConfig struct {
+	GridSize          int // cells per tile side, a power of two
+	PaintZoom         int // zoom of the canonical cell grid
+	MinZoom           int
+	MaxZoom           int
+	Palette           []string // allowed paint colors, normalized "#RRGGBB"
+	MaxCellsPerCommit int      // 0 is no limit
+	InkCosts          InkCosts
+}
+
+// InkCosts is how much ink painting one canonical cell takes.
+type InkCosts struct {
+	Paint     int // an empty cell
+	Overpaint int // a cell that is already painted
+}
+
+// GameConfigResponse is the structure for the response from GET /api/game/config.
+// Missing fields keep their defaults; fields that are present are used as is,
+// so min_zoom 0 is allowed.
+type GameConfigResponse struct {
+	GridSize          *int     `json:"grid_size"`
+	PaintZoom         *int     `json:"paint_zoom"`
+	MinZoom           *int     `json:"min_zoom"`
+	MaxZoom           *int     `json:"max_zoom"`
+	Palette           []string `json:"palette"`
+	MaxCellsPerCommit *int     `json:"max_cells_per_commit"`
+	InkCosts          struct {
+		Paint     *int `json:"paint"`
+		Overpaint *int `json:"overpaint"` // defaults to paint
+	} `json:"ink_costs"`
+}
+
+// defaultGameConfig returns the built-in rules.
+func defaultGameConfig() GameConfig {
+	return GameConfig{
+		GridSize:  defaultCellGridSize,
+		PaintZoom: defaultPaintZoom,
+		MinZoom:   defaultMinZoom,
+		MaxZoom:   defaultMaxZoom,
+		Palette:   append([]string(nil), defaultPalette...),
+		InkCosts:  InkCosts{Paint: defaultInkCost, Overpaint: defaultInkCost},
+	}
+}
+
+// config returns the rules in r, with the built-in ones for the missing
+// fields, and checks that the result can be drawn. A palette without valid
+// colors counts as missing.
+func (r GameConfigResponse) config() (GameConfig, error) {
+	d := defaultGameConfig()
+	c := GameConfig{
+		GridSize:          intOr(r.GridSize, d.GridSize),
+		PaintZoom:         intOr(r.PaintZoom, d.PaintZoom),
+		MinZoom:           intOr(r.MinZoom, d.MinZoom),
+		MaxZoom:           intOr(r.MaxZoom, d.MaxZoom),
+		Palette:           normalizePalette(r.Palette),
+		MaxCellsPerCommit: intOr(r.MaxCellsPerCommit, 0),
+	}
+	c.InkCosts.Paint = intOr(r.InkCosts.Paint, d.InkCosts.Paint)
+	c.InkCosts.Overpaint = intOr(r.InkCosts.Overpaint, c.InkCosts.Paint)
+	if len(c.Palette) == 0 {
+		c.Palette = d.Palette
+	}
+
+	switch {
+	case c.GridSize < 1 || c.GridSize > tileSize || c.GridSize&(c.GridSize-1) != 0:
+		return d, fmt.Errorf("grid size %d is not a power of two up to %d", c.GridSize, tileSize)
+	case c.MinZoom < 0 || c.MinZoom > c.MaxZoom:
+		return d, fmt.Errorf("zoom range %d-%d is invalid", c.MinZoom, c.MaxZoom)
+	case c.PaintZoom < c.MinZoom || c.PaintZoom > c.MaxZoom:
+		return d, fmt.Errorf("paint zoom %d is outside %d-%d", c.PaintZoom, c.MinZoom, c.MaxZoom)
+	case c.MaxCellsPerCommit < 0 || c.InkCosts.Paint < 0 || c.InkCosts.Overpaint < 0:
+		return d, fmt.Errorf("negative limits or ink costs")
+	}
+	return c, nil
+}
+
+// intOr returns *p, or def when the field was missing.
+func intOr(p *int, def int) int {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// OverCommitLimit reports whether the selection has more canonical cells than
+// one commit may paint.
+func (m *IchthyoMapView) OverCommitLimit() bool {
+	limit := m.Config.MaxCellsPerCommit
+	return limit > 0 && len(m.normalizedSelection()) > limit
+}
+
+// LoadGameConfig fetches the game rules from the server and applies them.
+// The current rules stay in use if that fails.
+func (m *IchthyoMapView) LoadGameConfig(onDone func()) {
+	getRequest(apiBaseURL+"/api/game/config", func(responseBody string) {
+		defer m.configDone()
+		var data GameConfigResponse
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+			fmt.Println("Failed to unmarshal game config:", err)
+			return
+		}
+		config, err := data.config()
+		if err != nil {
+			fmt.Println("Invalid game config, using the built-in rules:", err)
+			return
+		}
+		m.ApplyGameConfig(config)
+		if onDone != nil {
+			onDone()
+		}
+	}, func(errText string) {
+		fmt.Println("Failed to fetch game config, using the built-in rules:", errText)
+		m.configDone()
+	})
+}
+
+// configDone records that LoadGameConfig has finished and runs the draft
+// check that was waiting for it.
+func (m *IchthyoMapView) configDone() {
+	m.configLoaded = true
+	if m.draftCheckPending {
+		m.draftCheckPending = false
+		m.checkDraftWhenReady()
+	}
+}
+
+// ApplyGameConfig switches the map to config, which must have its defaults
+// filled in. If the cell grid changes, cached and pending paint and the
+// selection (which are on the old grid) are dropped, and so is a saved draft
+// that isn't on the new grid.
+func (m *IchthyoMapView) ApplyGameConfig(config GameConfig) {
+	gridChanged := config.GridSize != m.Config.GridSize || config.PaintZoom != m.Config.PaintZoom
+
+	m.Config = config
+	m.paletteChanged()
+	m.Zoom = m.clampZoom(m.Zoom)
+
+	if gridChanged {
+		hadSelection := len(m.SelectedCells) > 0
+		m.paintCache = make(map[geometry.TileCoord][]TileCell)
+		m.paintPending = make(map[geometry.TileCoord][]func())
+		m.paintVersion++
+		m.overviewCache = make(map[geometry.TileCoord]*overviewTile)
+		m.overviewPending = make(map[geometry.TileCoord]bool)
+		m.overviewServerless = false // the server may have overviews for the new grid
+		m.SelectedCells = make(map[cellRef]SelectedCellInfo)
+		m.selectionVersion++
+		m.ResetHistory()
+		m.placingPreview = placingPreview{}
+		m.hoverCell = nil
+
+		// 下書きは保存したときのグリッドと違うときだけ捨てる
+		droppedDraft := false
+		if d := m.pendingDraft; d != nil && !d.onGrid(config) {
+			m.pendingDraft = nil
+			m.draftChanged = 0
+			droppedDraft = true
+		}
+		if hadSelection || droppedDraft {
+			m.saveDraft()
+		}
+		if m.OnSelectionChange != nil {
+			m.OnSelectionChange()
+		}
+	}
+	if m.OnConfigChange != nil {
+		m.OnConfigChange()
+	}
+	m.redrawAll()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"syscall/js"
+	"time"
+
+	"ichthyo-cup-front/client/projection"
+)
+
+const (
+	layerLocation = "location"
+
+	locateZoom        = 16
+	locateFlyDuration = 1500 * time.Millisecond
+	locateTimeoutMs   = 10000
+
+	// Geolocation API error codes
+	geoPermissionDenied     = 1
+	geoPositionUnavailable  = 2
+	geoTimeout              = 3
+	geoUnsupported          = -1
+	earthCircumferenceMeter = 40075016.686
+)
+
+// GeoPosition is a position reported by a PositionProvider.
+type GeoPosition struct {
+	Lat      float64
+	Lng      float64
+	Accuracy float64 // radius in meters
+}
+
+// GeolocationError is returned when the position can't be determined.
+type GeolocationError struct {
+	Code    int
+	Message string
+}
+
+func (e *GeolocationError) Error() string {
+	switch e.Code {
+	case geoPermissionDenied:
+		return "Location permission denied. Allow location access in your browser settings."
+	case geoPositionUnavailable:
+		return "Your location is unavailable."
+	case geoTimeout:
+		return "Timed out while getting your location."
+	case geoUnsupported:
+		return "This browser doesn't support geolocation."
+	}
+	return e.Message
+}
+
+// PermissionDenied reports whether the user refused location access.
+func (e *GeolocationError) PermissionDenied() bool {
+	return e.Code == geoPermissionDenied
+}
+
+// PositionProvider looks up the user's current position. The browser's
+// Geolocation API is used by default; tests can inject their own.
+type PositionProvider interface {
+	CurrentPosition(onSuccess func(GeoPosition), onError func(*GeolocationError))
+}
+
+// PositionProviderFunc adapts a function to a PositionProvider.
+type PositionProviderFunc func(onSuccess func(GeoPosition), onError func(*GeolocationError))
+
+func (f PositionProviderFunc) CurrentPosition(onSuccess func(GeoPosition), onError func(*GeolocationError)) {
+	f(onSuccess, onError)
+}
+
+// browserGeolocation uses navigator.geolocation.
+type browserGeolocation struct{}
+
+func (browserGeolocation) CurrentPosition(onSuccess func(GeoPosition), onError func(*GeolocationError)) {
+	geo := js.Global().Get("navigator").Get("geolocation")
+	if geo.IsUndefined() || geo.IsNull() {
+		onError(&GeolocationError{Code: geoUnsupported})
+		return
+	}
+
+	var success, failure js.Func
+	release := func() {
+		success.Release()
+		failure.Release()
+	}
+	success = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		coords := args[0].Get("coords")
+		onSuccess(GeoPosition{
+			Lat:      coords.Get("latitude").Float(),
+			Lng:      coords.Get("longitude").Float(),
+			Accuracy: coords.Get("accuracy").Float(),
+		})
+		release()
+		return nil
+	})
+	failure = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		onError(&GeolocationError{Code: args[0].Get("code").Int(), Message: args[0].Get("message").String()})
+		release()
+		return nil
+	})
+	geo.Call("getCurrentPosition", success, failure, map[string]interface{}{
+		"enableHighAccuracy": true,
+		"timeout":            locateTimeoutMs,
+	})
+}
+
+// LocateMe looks up the user's position, shows it with an accuracy circle and
+// flies there. onError is called if the position can't be determined.
+func (m *IchthyoMapView) LocateMe(onError func(*GeolocationError)) {
+	provider := m.PositionProvider
+	if provider == nil {
+		provider = browserGeolocation{}
+	}
+	provider.CurrentPosition(func(pos GeoPosition) {
+		m.location = &pos
+		m.RedrawLayer(layerLocation)
+		m.FlyTo(pos.Lat, pos.Lng, math.Max(m.Zoom, locateZoom), locateFlyDuration)
+	}, func(err *GeolocationError) {
+		if onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// locationLayer draws the user's position and its accuracy circle.
+type locationLayer struct{ m *IchthyoMapView }
+
+func (l *locationLayer) ID() string { return layerLocation }
+
+func (l *locationLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	pos := l.m.location
+	if pos == nil {
+		return
+	}
+	wx, wy := projection.LatLngToWorld(pos.Lat, pos.Lng, float64(zoom))
+	x := wx - float64(tileX*tileSize)
+	y := wy - float64(tileY*tileSize)
+
+	// メートル→ピクセル（その緯度での解像度）
+	metersPerPixel := earthCircumferenceMeter * math.Cos(pos.Lat*math.Pi/180) / (math.Pow(2, float64(zoom)) * tileSize)
+	radius := pos.Accuracy / metersPerPixel
+	reach := math.Max(radius, 8)
+	if x+reach < 0 || y+reach < 0 || x-reach > tileSize || y-reach > tileSize {
+		return
+	}
+
+	ctx.Call("beginPath")
+	ctx.Call("arc", x, y, radius, 0, 2*math.Pi)
+	ctx.Set("fillStyle", "rgba(30, 136, 229, 0.15)")
+	ctx.Call("fill")
+	ctx.Set("strokeStyle", "rgba(30, 136, 229, 0.6)")
+	ctx.Set("lineWidth", 1)
+	ctx.Call("stroke")
+
+	ctx.Call("beginPath")
+	ctx.Call("arc", x, y, 6, 0, 2*math.Pi)
+	ctx.Set("fillStyle", "#1e88e5")
+	ctx.Call("fill")
+	ctx.Set("strokeStyle", "#ffffff")
+	ctx.Set("lineWidth", 2)
+	ctx.Call("stroke")
+}
@@ -0,0 +1,83 @@
+// Run under node with testdata/node_dom_stub.js, see there.
+
+package main
+
+import "testing"
+
+// fakeProvider answers with pos, or with err if it is set.
+func fakeProvider(pos GeoPosition, err *GeolocationError) PositionProvider {
+	return PositionProviderFunc(func(onSuccess func(GeoPosition), onError func(*GeolocationError)) {
+		if err != nil {
+			onError(err)
+			return
+		}
+		onSuccess(pos)
+	})
+}
+
+func TestLocateMe(t *testing.T) {
+	tests := []struct {
+		name     string
+		pos      GeoPosition
+		err      *GeolocationError
+		wantZoom float64
+	}{
+		{name: "success", pos: GeoPosition{Lat: 51.5, Lng: -0.12, Accuracy: 30}, wantZoom: locateZoom},
+		{name: "permission denied", err: &GeolocationError{Code: geoPermissionDenied, Message: "User denied Geolocation"}},
+		{name: "timeout", err: &GeolocationError{Code: geoTimeout, Message: "Timeout expired"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewIchthyoMapView()
+			m.Zoom = 12
+			lat, lng := m.CenterLat, m.CenterLng
+			m.PositionProvider = fakeProvider(tt.pos, tt.err)
+
+			var got *GeolocationError
+			m.LocateMe(func(err *GeolocationError) { got = err })
+
+			if tt.err != nil {
+				if got != tt.err {
+					t.Fatalf("onError got %v, want %v", got, tt.err)
+				}
+				if m.location != nil {
+					t.Errorf("location = %+v after an error, want none", *m.location)
+				}
+				if m.CenterLat != lat || m.CenterLng != lng || m.Zoom != 12 {
+					t.Errorf("view moved to %v,%v z%v after an error", m.CenterLat, m.CenterLng, m.Zoom)
+				}
+				return
+			}
+			if got != nil {
+				t.Fatalf("unexpected error %v", got)
+			}
+			if m.location == nil || *m.location != tt.pos {
+				t.Errorf("location = %v, want %+v", m.location, tt.pos)
+			}
+			if m.CenterLat != tt.pos.Lat || m.CenterLng != tt.pos.Lng || m.Zoom != tt.wantZoom {
+				t.Errorf("view = %v,%v z%v, want %v,%v z%v", m.CenterLat, m.CenterLng, m.Zoom, tt.pos.Lat, tt.pos.Lng, tt.wantZoom)
+			}
+		})
+	}
+}
+
+func TestGeolocationErrorMessages(t *testing.T) {
+	denied := &GeolocationError{Code: geoPermissionDenied, Message: "User denied Geolocation"}
+	if !denied.PermissionDenied() {
+		t.Error("PermissionDenied() = false for a permission error")
+	}
+	if denied.Error() == denied.Message {
+		t.Error("permission error shows the browser's message instead of a hint")
+	}
+	timeout := &GeolocationError{Code: geoTimeout, Message: "Timeout expired"}
+	if timeout.PermissionDenied() {
+		t.Error("PermissionDenied() = true for a timeout")
+	}
+	if got, want := timeout.Error(), "Timed out while getting your location."; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	other := &GeolocationError{Code: 42, Message: "something else"}
+	if got := other.Error(); got != "something else" {
+		t.Errorf("Error() = %q for an unknown code, want the browser's message", got)
+	}
+}
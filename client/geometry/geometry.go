@@ -0,0 +1,84 @@
+// Package geometry has the tile and cell coordinate types of the map. They are
+// comparable values, so they can be used directly as map keys.
+package geometry
+
+import "fmt"
+
+// TileCoord identifies a Web Mercator tile.
+type TileCoord struct {
+	Zoom, X, Y int
+}
+
+// String formats t as "zoom/x/y".
+func (t TileCoord) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Zoom, t.X, t.Y)
+}
+
+// Wrap returns t with X wrapped into [0, 2^Zoom), so tiles seen across the
+// antimeridian share the key of the tile they repeat.
+func (t TileCoord) Wrap() TileCoord {
+	n := 1 << uint(t.Zoom)
+	t.X = ((t.X % n) + n) % n
+	return t
+}
+
+// Valid reports whether t is inside the world at its zoom. X must be wrapped.
+func (t TileCoord) Valid() bool {
+	n := 1 << uint(t.Zoom)
+	return t.Zoom >= 0 && t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// Ancestor returns the tile at zoom containing t. zoom must not be deeper than t.
+func (t TileCoord) Ancestor(zoom int) TileCoord {
+	shift := uint(t.Zoom - zoom)
+	return TileCoord{Zoom: zoom, X: t.X >> shift, Y: t.Y >> shift}
+}
+
+// Overlaps reports whether t and o cover any common area.
+func (t TileCoord) Overlaps(o TileCoord) bool {
+	if t.Zoom > o.Zoom {
+		return t.Ancestor(o.Zoom) == o
+	}
+	return o.Ancestor(t.Zoom) == t
+}
+
+// CellCoord identifies one cell of a tile's GridSize x GridSize cell grid.
+type CellCoord struct {
+	Zoom, TileX, TileY, CellX, CellY int
+}
+
+// Tile returns the tile the cell belongs to.
+func (c CellCoord) Tile() TileCoord {
+	return TileCoord{Zoom: c.Zoom, X: c.TileX, Y: c.TileY}
+}
+
+// String formats c as "zoom/tile_x/tile_y/cell_x/cell_y".
+func (c CellCoord) String() string {
+	return fmt.Sprintf("%d/%d/%d/%d/%d", c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY)
+}
+
+// Global returns the cell's position on the zoom level's global cell grid.
+func (c CellCoord) Global(gridSize int) (gx, gy int) {
+	return c.TileX*gridSize + c.CellX, c.TileY*gridSize + c.CellY
+}
+
+// CellFromGlobal is the inverse of CellCoord.Global.
+func CellFromGlobal(zoom, gx, gy, gridSize int) CellCoord {
+	tileX, tileY := floorDiv(gx, gridSize), floorDiv(gy, gridSize)
+	return CellCoord{Zoom: zoom, TileX: tileX, TileY: tileY, CellX: gx - tileX*gridSize, CellY: gy - tileY*gridSize}
+}
+
+// Wrap returns c with its tile wrapped, see TileCoord.Wrap.
+func (c CellCoord) Wrap() CellCoord {
+	t := c.Tile().Wrap()
+	c.TileX = t.X
+	return c
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,57 @@
+package geometry
+
+import "testing"
+
+func TestCellFromGlobal(t *testing.T) {
+	tests := []struct {
+		gx, gy int
+		want   CellCoord
+	}{
+		{0, 0, CellCoord{Zoom: 5}},
+		{17, 35, CellCoord{Zoom: 5, TileX: 1, TileY: 2, CellX: 1, CellY: 3}},
+		{-1, -1, CellCoord{Zoom: 5, TileX: -1, TileY: -1, CellX: 15, CellY: 15}},
+		{-16, -17, CellCoord{Zoom: 5, TileX: -1, TileY: -2, CellX: 0, CellY: 15}},
+		{-33, 15, CellCoord{Zoom: 5, TileX: -3, TileY: 0, CellX: 15, CellY: 15}},
+	}
+	for _, tt := range tests {
+		got := CellFromGlobal(5, tt.gx, tt.gy, 16)
+		if got != tt.want {
+			t.Errorf("CellFromGlobal(5, %d, %d, 16) = %v, want %v", tt.gx, tt.gy, got, tt.want)
+		}
+		if gx, gy := got.Global(16); gx != tt.gx || gy != tt.gy {
+			t.Errorf("%v.Global(16) = %d, %d, want %d, %d", got, gx, gy, tt.gx, tt.gy)
+		}
+	}
+}
+
+func TestAncestorOverlaps(t *testing.T) {
+	tile := TileCoord{Zoom: 15, X: 29105, Y: 12903}
+	if got, want := tile.Ancestor(13), (TileCoord{Zoom: 13, X: 7276, Y: 3225}); got != want {
+		t.Errorf("Ancestor(13) = %v, want %v", got, want)
+	}
+	if !tile.Overlaps(tile.Ancestor(2)) || !tile.Ancestor(2).Overlaps(tile) {
+		t.Error("a tile doesn't overlap its ancestor")
+	}
+	if tile.Overlaps(TileCoord{Zoom: 15, X: 29106, Y: 12903}) {
+		t.Error("neighboring tiles overlap")
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		tile TileCoord
+		want bool
+	}{
+		{TileCoord{Zoom: 0}, true},
+		{TileCoord{Zoom: 3, X: 7, Y: 7}, true},
+		{TileCoord{Zoom: 3, X: 8, Y: 0}, false},
+		{TileCoord{Zoom: 3, X: 0, Y: 8}, false},
+		{TileCoord{Zoom: 3, X: 0, Y: -1}, false},
+		{TileCoord{Zoom: -1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tile.Valid(); got != tt.want {
+			t.Errorf("%v.Valid() = %v, want %v", tt.tile, got, tt.want)
+		}
+	}
+}
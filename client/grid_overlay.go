@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"syscall/js"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+const (
+	layerGrid  = "grid"
+	layerHover = "hover"
+
+	gridLineColor = "rgba(0, 0, 0, 0.35)"
+)
+
+// cellRef identifies one cell of a tile at a zoom level. Paint and selections
+// use canonical cells, the cells of tiles at the paint zoom; other zooms
+// only project them.
+type cellRef = geometry.CellCoord
+
+// toCanonical returns the canonical cell containing c, or for cells coarser
+// than the canonical grid, the top-left canonical cell it covers.
+func (m *IchthyoMapView) toCanonical(c cellRef) cellRef {
+	gx, gy := m.globalCell(c)
+	if c.Zoom >= m.Config.PaintZoom {
+		shift := uint(c.Zoom - m.Config.PaintZoom)
+		return m.cellFromGlobal(m.Config.PaintZoom, gx>>shift, gy>>shift)
+	}
+	shift := uint(m.Config.PaintZoom - c.Zoom)
+	return m.cellFromGlobal(m.Config.PaintZoom, gx<<shift, gy<<shift)
+}
+
+// cellAt returns the canonical cell under a screen position, whatever zoom is
+// displayed. This is the tile/cell math handleClick uses.
+func (m *IchthyoMapView) cellAt(clientX, clientY float64) cellRef {
+	return m.viewport().CellAt(clientX, clientY, m.Config.PaintZoom, m.Config.GridSize)
+}
+
+// gridLayer draws the canonical cell boundaries. It fades in over the zoom
+// level below the paint zoom.
+type gridLayer struct{ m *IchthyoMapView }
+
+func (l *gridLayer) ID() string { return layerGrid }
+
+func (l *gridLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	if !l.m.ShowGrid {
+		return
+	}
+	alpha := math.Min(math.Max(l.m.Zoom-float64(l.m.Config.PaintZoom-1), 0), 1)
+	if alpha == 0 {
+		return
+	}
+	// 正規セルの表示上の大きさ
+	cellPixelSize := float64(tileSize) / float64(l.m.Config.GridSize) * math.Pow(2, float64(zoom-l.m.Config.PaintZoom))
+	offsetX := math.Mod(-float64(tileX*tileSize), cellPixelSize)
+	offsetY := math.Mod(-float64(tileY*tileSize), cellPixelSize)
+
+	ctx.Set("globalAlpha", alpha)
+	ctx.Set("strokeStyle", gridLineColor)
+	ctx.Set("lineWidth", 1)
+	ctx.Call("beginPath")
+	for p := offsetX; p <= tileSize; p += cellPixelSize {
+		ctx.Call("moveTo", p+0.5, 0)
+		ctx.Call("lineTo", p+0.5, tileSize)
+	}
+	for p := offsetY; p <= tileSize; p += cellPixelSize {
+		ctx.Call("moveTo", 0, p+0.5)
+		ctx.Call("lineTo", tileSize, p+0.5)
+	}
+	ctx.Call("stroke")
+	ctx.Set("globalAlpha", 1)
+}
+
+// hoverLayer previews the selected color on the cell under the cursor.
+type hoverLayer struct{ m *IchthyoMapView }
+
+func (l *hoverLayer) ID() string { return layerHover }
+
+func (l *hoverLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	h := l.m.hoverCell
+	if h == nil {
+		return
+	}
+	x, y, size, ok := l.m.cellRectInTile(h.Zoom, h.TileX, h.TileY, h.CellX, h.CellY, zoom, tileX, tileY)
+	if !ok {
+		return
+	}
+
+	ctx.Set("globalAlpha", 0.6)
+	ctx.Set("fillStyle", l.m.SelectedColor)
+	ctx.Call("fillRect", x, y, size, size)
+	ctx.Set("globalAlpha", 1)
+	ctx.Set("strokeStyle", "#ffffff")
+	ctx.Set("lineWidth", 1)
+	ctx.Call("strokeRect", x+0.5, y+0.5, size-1, size-1)
+}
+
+// setHoverCell moves the hover highlight, redrawing only the affected tiles.
+func (m *IchthyoMapView) setHoverCell(c *cellRef) {
+	prev := m.hoverCell
+	if prev == nil && c == nil {
+		return
+	}
+	if prev != nil && c != nil && *prev == *c {
+		return
+	}
+	m.hoverCell = c
+	if prev != nil {
+		m.RedrawLayerArea(layerHover, prev.Zoom, prev.TileX, prev.TileY)
+	}
+	if c != nil {
+		m.RedrawLayerArea(layerHover, c.Zoom, c.TileX, c.TileY)
+	}
+	if m.placing != nil {
+		m.RedrawLayer(layerPatternPreview)
+	}
+}
+
+// SetShowGrid turns the cell grid overlay on or off.
+func (m *IchthyoMapView) SetShowGrid(show bool) {
+	m.ShowGrid = show
+	m.RedrawLayer(layerGrid)
+}
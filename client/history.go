@@ -0,0 +1,183 @@
+package main
+
+import (
+	"syscall/js"
+)
+
+const maxHistory = 100 // undo steps kept
+
+// cellChange is the state of one SelectedCells entry before and after an edit.
+// nil means the cell wasn't selected.
+type cellChange struct {
+	before, after *SelectedCellInfo
+}
+
+// selectionCommand is one undoable edit of SelectedCells: a click, a tool
+// stroke or a clear.
+type selectionCommand struct {
+	Name    string
+	changes map[cellRef]cellChange
+}
+
+// selectionHistory holds the undo and redo stacks.
+type selectionHistory struct {
+	undo []*selectionCommand
+	redo []*selectionCommand
+	open *selectionCommand // command being recorded
+}
+
+// beginEdit starts recording a command. Edits made until endEdit are undone
+// together. It returns false if a command is already being recorded, in which
+// case the edits join that one.
+func (m *IchthyoMapView) beginEdit(name string) bool {
+	if m.history.open != nil {
+		return false
+	}
+	m.history.open = &selectionCommand{Name: name, changes: make(map[cellRef]cellChange)}
+	return true
+}
+
+// endEdit pushes the recorded command onto the undo stack.
+func (m *IchthyoMapView) endEdit() {
+	cmd := m.history.open
+	m.history.open = nil
+	if cmd == nil || len(cmd.changes) == 0 {
+		return
+	}
+	m.history.undo = append(m.history.undo, cmd)
+	if len(m.history.undo) > maxHistory {
+		m.history.undo = m.history.undo[len(m.history.undo)-maxHistory:]
+	}
+	m.history.redo = nil
+}
+
+// edit runs fn as one undoable command.
+func (m *IchthyoMapView) edit(name string, fn func()) {
+	if m.beginEdit(name) {
+		defer m.endEdit()
+	}
+	fn()
+}
+
+// setSelected selects (info != nil) or deselects a cell, recording the change
+// in the open command.
+func (m *IchthyoMapView) setSelected(key cellRef, info *SelectedCellInfo) {
+	var before *SelectedCellInfo
+	if cur, ok := m.SelectedCells[key]; ok {
+		before = &cur
+	}
+	if info == nil {
+		delete(m.SelectedCells, key)
+	} else {
+		m.SelectedCells[key] = *info
+	}
+	m.selectionVersion++
+
+	if cmd := m.history.open; cmd != nil {
+		ch, seen := cmd.changes[key]
+		if !seen {
+			ch.before = before
+		}
+		ch.after = info
+		cmd.changes[key] = ch
+	}
+	m.scheduleDraftSave()
+}
+
+// ClearSelection deselects every cell as one undoable command.
+func (m *IchthyoMapView) ClearSelection() {
+	if len(m.SelectedCells) == 0 {
+		return
+	}
+	m.edit("Clear", func() {
+		for key := range m.SelectedCells {
+			m.setSelected(key, nil)
+		}
+	})
+	m.RedrawLayer(layerSelection)
+	if m.OnSelectionChange != nil {
+		m.OnSelectionChange()
+	}
+}
+
+// Undo reverts the last selection command.
+func (m *IchthyoMapView) Undo() {
+	n := len(m.history.undo)
+	if n == 0 {
+		return
+	}
+	cmd := m.history.undo[n-1]
+	m.history.undo = m.history.undo[:n-1]
+	m.history.redo = append(m.history.redo, cmd)
+	m.applyCommand(cmd, true)
+}
+
+// Redo reapplies the last undone command.
+func (m *IchthyoMapView) Redo() {
+	n := len(m.history.redo)
+	if n == 0 {
+		return
+	}
+	cmd := m.history.redo[n-1]
+	m.history.redo = m.history.redo[:n-1]
+	m.history.undo = append(m.history.undo, cmd)
+	m.applyCommand(cmd, false)
+}
+
+// CanUndo reports whether there is anything to undo.
+func (m *IchthyoMapView) CanUndo() bool { return len(m.history.undo) > 0 }
+
+// CanRedo reports whether there is anything to redo.
+func (m *IchthyoMapView) CanRedo() bool { return len(m.history.redo) > 0 }
+
+// ResetHistory forgets all undo and redo steps.
+func (m *IchthyoMapView) ResetHistory() {
+	m.history = selectionHistory{}
+}
+
+func (m *IchthyoMapView) applyCommand(cmd *selectionCommand, undo bool) {
+	for key, ch := range cmd.changes {
+		state := ch.after
+		if undo {
+			state = ch.before
+		}
+		if state == nil {
+			delete(m.SelectedCells, key)
+		} else {
+			m.SelectedCells[key] = *state
+		}
+	}
+	m.selectionVersion++
+	m.scheduleDraftSave()
+	m.RedrawLayer(layerSelection)
+	if m.OnSelectionChange != nil {
+		m.OnSelectionChange()
+	}
+}
+
+// onKeyDown binds Ctrl+Z to undo and Ctrl+Shift+Z / Ctrl+Y to redo, and
+// Escape to cancel placing a pattern.
+func (m *IchthyoMapView) onKeyDown(this js.Value, args []js.Value) interface{} {
+	e := args[0]
+	if e.Get("key").String() == "Escape" {
+		m.CancelPlacing()
+		return nil
+	}
+	if !e.Get("ctrlKey").Bool() && !e.Get("metaKey").Bool() {
+		return nil
+	}
+	// 入力欄での Ctrl+Z はブラウザに任せる
+	switch e.Get("target").Get("tagName").String() {
+	case "INPUT", "TEXTAREA":
+		return nil
+	}
+	switch key := e.Get("key").String(); {
+	case (key == "z" || key == "Z") && e.Get("shiftKey").Bool(), key == "y":
+		e.Call("preventDefault")
+		m.Redo()
+	case key == "z":
+		e.Call("preventDefault")
+		m.Undo()
+	}
+	return nil
+}
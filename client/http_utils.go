@@ -99,3 +99,61 @@ func storeUserData(token string, userID string) {
 	localStorage.Call("setItem", "jwt_token", token)
 	localStorage.Call("setItem", "ichthyo_user", userID)
 }
+
+// storedUserID returns the user ID saved by storeUserData, or "" if not logged in.
+func storedUserID() string {
+	v := js.Global().Get("localStorage").Call("getItem", "ichthyo_user")
+	if v.IsNull() || v.IsUndefined() {
+		return ""
+	}
+	return v.String()
+}
+
+// authorizedRequest sends a request with the stored JWT as a Bearer token.
+// body may be nil for requests without one.
+func authorizedRequest(method, url string, body []byte, onSuccess, onError func(string)) {
+	token := js.Global().Get("localStorage").Call("getItem", "jwt_token")
+	go func() {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			if onError != nil {
+				onError("Failed to create request: " + err.Error())
+			}
+			return
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if !token.IsNull() && !token.IsUndefined() {
+			req.Header.Set("Authorization", "Bearer "+token.String())
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if onError != nil {
+				onError("Request failed: " + err.Error())
+			}
+			return
+		}
+		defer resp.Body.Close()
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			if onError != nil {
+				onError("Failed to read response body: " + err.Error())
+			}
+			return
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if onSuccess != nil {
+				onSuccess(string(respBody))
+			}
+		} else {
+			if onError != nil {
+				onError(fmt.Sprintf("API Error (status %d): %s", resp.StatusCode, string(respBody)))
+			}
+		}
+	}()
+}
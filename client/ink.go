@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// InfoResponse is the part of the response from GET /api/info_return the map uses
+type InfoResponse struct {
+	InkAmount *int `json:"ink_amount"`
+}
+
+// PaintPostResponse is the part of the response from POST /api/paint the map uses
+type PaintPostResponse struct {
+	RemainingPaint *int `json:"remaining_paint"`
+}
+
+// selectionCost is the last result of SelectionCost and what it was computed from.
+type selectionCost struct {
+	selectionVersion int
+	paintVersion     int
+	costs            InkCosts
+	cost             int
+	valid            bool
+}
+
+// SelectionCost returns how much ink committing the selection takes, see
+// cellCost. The result is cached until the selection, the paint or the ink
+// costs change, since the UI asks for it on every render.
+func (m *IchthyoMapView) SelectionCost() int {
+	cached := m.selectionCost
+	if cached.valid && cached.selectionVersion == m.selectionVersion && cached.paintVersion == m.paintVersion && cached.costs == m.Config.InkCosts {
+		return cached.cost
+	}
+	cost := 0
+	for c := range m.normalizedSelection() {
+		cost += m.cellCost(c)
+	}
+	m.selectionCost = selectionCost{selectionVersion: m.selectionVersion, paintVersion: m.paintVersion, costs: m.Config.InkCosts, cost: cost, valid: true}
+	return cost
+}
+
+// cellCost returns the ink painting a canonical cell takes under the game
+// config. Cells whose tile isn't loaded yet count as empty.
+func (m *IchthyoMapView) cellCost(c cellRef) int {
+	if painted, _ := m.paintedColor(c); painted != "" {
+		return m.Config.InkCosts.Overpaint
+	}
+	return m.Config.InkCosts.Paint
+}
+
+// inkLeft returns how much more ink the selection can take, or -1 when the
+// ink balance is unknown.
+func (m *IchthyoMapView) inkLeft() int {
+	if m.InkBalance < 0 {
+		return -1
+	}
+	if left := m.InkBalance - m.SelectionCost(); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// OverBudget reports whether the selection costs more ink than the user has.
+func (m *IchthyoMapView) OverBudget() bool {
+	return m.InkBalance >= 0 && m.SelectionCost() > m.InkBalance
+}
+
+func (m *IchthyoMapView) setInkBalance(ink int) {
+	m.InkBalance = ink
+	if m.OnInkChange != nil {
+		m.OnInkChange()
+	}
+}
+
+// RefreshInk fetches the user's ink balance. The user is identified by the JWT.
+func (m *IchthyoMapView) RefreshInk() {
+	if m.CurrentUserID == "" && storedUserID() == "" {
+		return
+	}
+	authorizedRequest("GET", apiBaseURL+"/api/info_return", nil, func(responseBody string) {
+		var data InfoResponse
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+			fmt.Println("Failed to unmarshal ink info:", err)
+			return
+		}
+		if data.InkAmount == nil {
+			fmt.Println("Ink amount missing from info response:", responseBody)
+			return
+		}
+		m.setInkBalance(*data.InkAmount)
+	}, func(errText string) {
+		fmt.Println("Failed to fetch ink amount:", errText)
+	})
+}
+
+// remainingInk returns the balance from a POST /api/paint response, if it has one.
+func remainingInk(responseBody string) (int, bool) {
+	var data PaintPostResponse
+	if err := json.Unmarshal([]byte(responseBody), &data); err != nil || data.RemainingPaint == nil {
+		return 0, false
+	}
+	return *data.RemainingPaint, true
+}
+
+// inkExceeded reports cells that weren't selected for lack of ink.
+func (m *IchthyoMapView) inkExceeded(skipped int) {
+	if skipped > 0 && m.OnInkExceeded != nil {
+		m.OnInkExceeded(skipped)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const maxInspectorHistory = 10 // history entries shown
+
+// CellHistoryEntry is one past paint of a cell
+type CellHistoryEntry struct {
+	Color     string `json:"color"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	PaintedAt string `json:"painted_at"`
+}
+
+// CellInfoResponse is the structure for the response from GET /api/paint/cell
+type CellInfoResponse struct {
+	Zoom      int                `json:"zoom"`
+	TileX     int                `json:"tile_x"`
+	TileY     int                `json:"tile_y"`
+	CellX     int                `json:"cell_x"`
+	CellY     int                `json:"cell_y"`
+	Color     string             `json:"color"`
+	UserID    string             `json:"user_id"`
+	Username  string             `json:"username"`
+	PaintedAt string             `json:"painted_at"`
+	History   []CellHistoryEntry `json:"history"` // newest first, not including the current paint
+}
+
+// FetchCellInfo loads the owner and paint history of a cell.
+func (m *IchthyoMapView) FetchCellInfo(c cellRef, onDone func(*CellInfoResponse), onError func(string)) {
+	endpoint := fmt.Sprintf("%s/api/paint/cell?zoom=%d&tile_x=%d&tile_y=%d&cell_x=%d&cell_y=%d", apiBaseURL, c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY)
+	getRequest(endpoint, func(responseBody string) {
+		var data CellInfoResponse
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+			onError("Failed to unmarshal cell info: " + err.Error())
+			return
+		}
+		onDone(&data)
+	}, onError)
+}
+
+// formatPaintedAt formats an RFC 3339 timestamp in local time.
+func formatPaintedAt(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// CellInspector is a popup showing who painted a cell, when, and what was
+// there before.
+type CellInspector struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	cell    *cellRef
+	x, y    float64 // screen position of the click
+	info    *CellInfoResponse
+	loading bool
+	err     string
+}
+
+// NewCellInspector creates a cell inspector for mapView.
+func NewCellInspector(mapView *IchthyoMapView) *CellInspector {
+	return &CellInspector{MapView: mapView}
+}
+
+// Open shows the popup for c at the given screen position and loads its info.
+func (p *CellInspector) Open(c cellRef, clientX, clientY float64) {
+	p.cell = &c
+	p.x, p.y = clientX, clientY
+	p.info, p.err, p.loading = nil, "", true
+	vecty.Rerender(p)
+
+	p.MapView.FetchCellInfo(c, func(info *CellInfoResponse) {
+		if p.cell == nil || *p.cell != c {
+			return // 別のセルを開いた
+		}
+		p.info, p.loading = info, false
+		vecty.Rerender(p)
+	}, func(errText string) {
+		if p.cell == nil || *p.cell != c {
+			return
+		}
+		p.err, p.loading = errText, false
+		vecty.Rerender(p)
+	})
+}
+
+// Close hides the popup.
+func (p *CellInspector) Close() {
+	p.cell = nil
+	vecty.Rerender(p)
+}
+
+func (p *CellInspector) Render() vecty.ComponentOrHTML {
+	if p.cell == nil {
+		return elem.Div()
+	}
+	c := *p.cell
+
+	var body vecty.List
+	switch {
+	case p.info != nil:
+		body = p.renderInfo(p.info)
+	case p.loading:
+		body = vecty.List{elem.Div(vecty.Text("Loading..."))}
+	default:
+		// サーバーから取れなくてもキャッシュの持ち主は出す
+		color, _ := p.MapView.paintedColor(c)
+		owner, _ := p.MapView.CellOwner(c)
+		body = vecty.List{
+			p.renderRow("Color", color),
+			p.renderRow("Owner", owner),
+			elem.Div(vecty.Markup(vecty.Style("color", "#ff8080")), vecty.Text("History unavailable: "+p.err)),
+		}
+	}
+
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("left", fmt.Sprintf("%.0fpx", p.x+12)), vecty.Style("top", fmt.Sprintf("%.0fpx", p.y+12)), vecty.Style("minWidth", "200px"), vecty.Style("background", "rgba(0,0,0,0.8)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("fontSize", "12px"), vecty.Style("zIndex", "1002")),
+		elem.Div(
+			vecty.Markup(vecty.Style("display", "flex"), vecty.Style("justifyContent", "space-between"), vecty.Style("gap", "10px")),
+			elem.Span(vecty.Markup(vecty.Style("fontWeight", "bold")), vecty.Text(formatTileCell(c))),
+			elem.Button(vecty.Text("×"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				p.Close()
+			}))),
+		),
+		body,
+	)
+}
+
+func (p *CellInspector) renderInfo(info *CellInfoResponse) vecty.List {
+	if info.Color == "" {
+		return vecty.List{elem.Div(vecty.Text("Not painted yet"))}
+	}
+	list := vecty.List{
+		p.renderRow("Color", info.Color),
+		p.renderRow("Owner", displayName(info.Username, info.UserID)),
+		p.renderRow("Painted", formatPaintedAt(info.PaintedAt)),
+	}
+	if len(info.History) == 0 {
+		return list
+	}
+
+	var rows vecty.List
+	for i, h := range info.History {
+		if i == maxInspectorHistory {
+			break
+		}
+		rows = append(rows, elem.TableRow(
+			elem.TableData(elem.Span(vecty.Markup(vecty.Style("display", "inline-block"), vecty.Style("width", "10px"), vecty.Style("height", "10px"), vecty.Style("background", h.Color)))),
+			elem.TableData(vecty.Text(displayName(h.Username, h.UserID))),
+			elem.TableData(vecty.Text(formatPaintedAt(h.PaintedAt))),
+		))
+	}
+	return append(list,
+		elem.Div(vecty.Markup(vecty.Style("marginTop", "5px"), vecty.Style("fontWeight", "bold")), vecty.Text("History")),
+		elem.Table(elem.TableBody(rows)),
+	)
+}
+
+func (p *CellInspector) renderRow(label, value string) vecty.ComponentOrHTML {
+	if value == "" {
+		value = "-"
+	}
+	return elem.Div(vecty.Text(label + ": " + value))
+}
+
+// displayName prefers the username and falls back to the user ID.
+func displayName(username, userID string) string {
+	if username != "" {
+		return username
+	}
+	return userID
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"syscall/js"
+	"time"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+// Layer IDs of the built-in layers, bottom to top.
+const (
+	layerBase      = "base"
+	layerPaint     = "paint"
+	layerSelection = "selection"
+	layerButtons   = "buttons"
+)
+
+// Layer draws one canvas of a map tile. Each layer gets its own canvas per tile,
+// stacked in the order the layers were added, so it can be redrawn on its own.
+type Layer interface {
+	ID() string
+	DrawTile(ctx js.Value, zoom, tileX, tileY int)
+}
+
+// mapTile is one displayed tile: a positioned div holding one canvas per layer.
+type mapTile struct {
+	Zoom, X, Y int
+	element    js.Value
+	canvases   map[string]js.Value
+}
+
+// Tile returns the displayed tile's coordinate, not wrapped.
+func (t *mapTile) Tile() geometry.TileCoord {
+	return geometry.TileCoord{Zoom: t.Zoom, X: t.X, Y: t.Y}
+}
+
+// AddLayer adds an overlay on top of the existing layers and redraws.
+func (m *IchthyoMapView) AddLayer(l Layer) {
+	m.RemoveLayer(l.ID())
+	m.layers = append(m.layers, l)
+	m.resetTiles()
+	m.DrawMap()
+}
+
+// RemoveLayer removes the layer with the given ID, if present.
+func (m *IchthyoMapView) RemoveLayer(id string) {
+	for i, l := range m.layers {
+		if l.ID() == id {
+			m.layers = append(m.layers[:i], m.layers[i+1:]...)
+			m.resetTiles()
+			m.DrawMap()
+			return
+		}
+	}
+}
+
+// resetTiles drops every tile, so the next DrawMap creates them with the
+// current layers.
+func (m *IchthyoMapView) resetTiles() {
+	for key, t := range m.tiles {
+		t.element.Call("remove")
+		delete(m.tiles, key)
+	}
+}
+
+// redrawAll draws every layer of the visible tiles again, for changes that
+// affect all of them, like a new base map or game config.
+func (m *IchthyoMapView) redrawAll() {
+	for _, t := range m.tiles {
+		m.drawTile(t)
+	}
+	m.DrawMap()
+}
+
+// RedrawLayer redraws a single layer on every visible tile.
+func (m *IchthyoMapView) RedrawLayer(id string) {
+	for _, t := range m.tiles {
+		m.redrawLayerOnTile(id, t)
+	}
+}
+
+// RedrawLayerTile redraws a single layer on one tile, if it is visible.
+func (m *IchthyoMapView) RedrawLayerTile(id string, zoom, tileX, tileY int) {
+	if t, ok := m.tiles[geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}]; ok {
+		m.redrawLayerOnTile(id, t)
+	}
+}
+
+// RedrawLayerArea redraws a single layer on every visible tile that overlaps
+// tile (tileX, tileY) at zoom, whatever zoom is displayed, including the
+// copies of it across the antimeridian.
+func (m *IchthyoMapView) RedrawLayerArea(id string, zoom, tileX, tileY int) {
+	area := geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}.Wrap()
+	for _, t := range m.tiles {
+		if t.Tile().Wrap().Overlaps(area) {
+			m.redrawLayerOnTile(id, t)
+		}
+	}
+}
+
+func (m *IchthyoMapView) redrawLayerOnTile(id string, t *mapTile) {
+	for _, l := range m.layers {
+		if l.ID() == id {
+			m.drawLayerTile(l, t)
+			return
+		}
+	}
+}
+
+func (m *IchthyoMapView) drawLayerTile(l Layer, t *mapTile) {
+	canvas, ok := t.canvases[l.ID()]
+	if !ok {
+		return
+	}
+	ctx := canvas.Call("getContext", "2d")
+	ctx.Call("clearRect", 0, 0, tileSize, tileSize)
+	l.DrawTile(ctx, t.Zoom, t.X, t.Y)
+}
+
+// newMapTile creates the tile element with one canvas per layer. It is placed
+// with moveTo.
+func (m *IchthyoMapView) newMapTile(zoom, tileX, tileY int) *mapTile {
+	doc := js.Global().Get("document")
+	t := &mapTile{Zoom: zoom, X: tileX, Y: tileY, canvases: make(map[string]js.Value)}
+
+	t.element = doc.Call("createElement", "div")
+	style := t.element.Get("style")
+	style.Set("position", "absolute")
+	style.Set("width", fmt.Sprintf("%dpx", tileSize))
+	style.Set("height", fmt.Sprintf("%dpx", tileSize))
+
+	for _, l := range m.layers {
+		canvas := doc.Call("createElement", "canvas")
+		canvas.Set("width", tileSize)
+		canvas.Set("height", tileSize)
+		cs := canvas.Get("style")
+		cs.Set("position", "absolute")
+		cs.Set("top", "0")
+		cs.Set("left", "0")
+		cs.Set("pointer-events", "none")
+		t.element.Call("appendChild", canvas)
+		t.canvases[l.ID()] = canvas
+	}
+	return t
+}
+
+// moveTo positions the tile in the tile container.
+func (t *mapTile) moveTo(left, top float64) {
+	style := t.element.Get("style")
+	style.Set("left", fmt.Sprintf("%.3fpx", left))
+	style.Set("top", fmt.Sprintf("%.3fpx", top))
+}
+
+// cellRectInTile projects a cell of a tile at cellZoom onto tile (tileX, tileY) at zoom.
+// It returns the cell's rectangle in that tile's canvas pixels, and false if they don't overlap.
+func (m *IchthyoMapView) cellRectInTile(cellZoom, cellTileX, cellTileY, cellX, cellY, zoom, tileX, tileY int) (x, y, size float64, ok bool) {
+	f := math.Pow(2, float64(zoom-cellZoom))
+	cellPixelSize := float64(tileSize) / float64(m.Config.GridSize)
+	size = cellPixelSize * f
+	x = (float64(cellTileX*tileSize)+float64(cellX)*cellPixelSize)*f - float64(tileX*tileSize)
+	y = (float64(cellTileY*tileSize)+float64(cellY)*cellPixelSize)*f - float64(tileY*tileSize)
+	ok = x < tileSize && y < tileSize && x+size > 0 && y+size > 0
+	return x, y, size, ok
+}
+
+// --- Built-in layers ---
+
+// baseLayer draws the placeholder and the tile source image.
+type baseLayer struct{ m *IchthyoMapView }
+
+func (l *baseLayer) ID() string { return layerBase }
+
+func (l *baseLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	// まずプレースホルダ背景
+	ctx.Set("fillStyle", "#f2f2f2")
+	ctx.Call("fillRect", 0, 0, tileSize, tileSize)
+
+	// 背景タイル読み込み（成功時に下地として描く）
+	url, sx, sy, sw := l.m.baseTileFor(tileX, tileY, zoom)
+	if url == "" {
+		return
+	}
+	img := js.Global().Get("Image").New()
+	var onLoad, onError js.Func
+	release := func() {
+		img.Call("removeEventListener", "load", onLoad)
+		img.Call("removeEventListener", "error", onError)
+		onLoad.Release()
+		onError.Release()
+	}
+	onLoad = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		ctx.Call("drawImage", img, sx, sy, sw, sw, 0, 0, tileSize, tileSize)
+		return nil
+	})
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		return nil
+	})
+	img.Call("addEventListener", "load", onLoad)
+	img.Call("addEventListener", "error", onError)
+	img.Set("src", url)
+}
+
+// paintLayer draws painted cells from paintCache, fetching tiles it hasn't seen yet.
+type paintLayer struct{ m *IchthyoMapView }
+
+func (l *paintLayer) ID() string { return layerPaint }
+
+func (l *paintLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	if zoom < l.m.Config.PaintZoom {
+		return
+	}
+	// 表示タイルを含む正規グリッドのタイルを描く
+	c := geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}.Ancestor(l.m.Config.PaintZoom)
+	cells, ok := l.m.paintCache[c.Wrap()]
+	if !ok {
+		l.m.fetchPaintTile(c.Zoom, c.X, c.Y)
+		return
+	}
+	for _, cell := range cells {
+		x, y, size, ok := l.m.cellRectInTile(c.Zoom, c.X, c.Y, cell.CellX, cell.CellY, zoom, tileX, tileY)
+		if !ok {
+			continue
+		}
+		ctx.Set("fillStyle", cell.Color)
+		ctx.Call("fillRect", x, y, size, size)
+	}
+}
+
+// selectionLayer draws the pending SelectedCells.
+type selectionLayer struct{ m *IchthyoMapView }
+
+func (l *selectionLayer) ID() string { return layerSelection }
+
+func (l *selectionLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	for c, selection := range l.m.SelectedCells {
+		// 選択したズームと表示中のズームが違っても同じ場所に描く
+		x, y, size, ok := l.m.cellRectInTile(c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY, zoom, tileX, tileY)
+		if !ok {
+			continue
+		}
+		ctx.Set("fillStyle", selection.Payload.Color)
+		ctx.Call("fillRect", x, y, size, size)
+	}
+}
+
+// InkRecoveryButton is a button returned by GET /api/paint/button.
+// Its position is a canonical cell.
+type InkRecoveryButton struct {
+	ID      string `json:"id"`
+	TileX   int    `json:"tile_x"`
+	TileY   int    `json:"tile_y"`
+	CellX   int    `json:"cell_x"`
+	CellY   int    `json:"cell_y"`
+	Success int    `json:"success"`
+	Fail    int    `json:"fail"`
+}
+
+// buttonLayer draws today's ink recovery buttons.
+type buttonLayer struct{ m *IchthyoMapView }
+
+func (l *buttonLayer) ID() string { return layerButtons }
+
+func (l *buttonLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	for _, b := range l.m.RecoveryButtons {
+		x, y, size, ok := l.m.cellRectInTile(l.m.Config.PaintZoom, b.TileX, b.TileY, b.CellX, b.CellY, zoom, tileX, tileY)
+		if !ok {
+			continue
+		}
+		ctx.Set("globalAlpha", 0.8)
+		ctx.Set("fillStyle", "#ffa500")
+		ctx.Call("fillRect", x, y, size, size)
+		ctx.Set("globalAlpha", 1)
+		ctx.Set("strokeStyle", "#ff6b6b")
+		ctx.Set("lineWidth", 2)
+		ctx.Call("strokeRect", x, y, size, size)
+	}
+}
+
+// LoadRecoveryButtons fetches today's ink recovery buttons and shows them on the buttons layer.
+func (m *IchthyoMapView) LoadRecoveryButtons() {
+	url := apiBaseURL + "/api/paint/button?date=" + time.Now().UTC().Format("2006-01-02")
+	getRequest(url, func(responseBody string) {
+		var data struct {
+			Buttons []InkRecoveryButton `json:"buttons"`
+		}
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+			m.Notifications.Notify(SeverityWarning, "Failed to read today's ink recovery buttons: "+err.Error())
+			return
+		}
+		m.RecoveryButtons = data.Buttons
+		m.RedrawLayer(layerButtons)
+	}, func(errText string) {
+		m.Notifications.Notify(SeverityWarning, "Failed to load today's ink recovery buttons: "+errText, ToastAction{Label: "Retry", Do: m.LoadRecoveryButtons})
+	})
+}
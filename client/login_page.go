@@ -15,10 +15,10 @@ const apiBaseURL = "https://hack-s-ikuthio-2025.vercel.app"
 // LoginPage is a component that displays a login form.
 type LoginPage struct {
 	vecty.Core
-	username string
-	password string
-	message  string
-	OnLogin  func()
+	username      string
+	password      string
+	OnLogin       func()
+	Notifications *NotificationCenter
 }
 
 // onLoginAttempt handles the login attempt by calling the backend API.
@@ -30,33 +30,26 @@ func (p *LoginPage) onLoginAttempt(e *vecty.Event) {
 			// Parse JWT response
 			var loginResp LoginResponse
 			if err := json.Unmarshal([]byte(response), &loginResp); err != nil {
-				p.message = "Failed to parse login response: " + err.Error()
-				vecty.Rerender(p)
+				p.Notifications.Notify(SeverityError, "Failed to parse login response: "+err.Error())
 				return
 			}
 
 			// Parse JWT token to get user ID
 			payload, err := parseJWT(loginResp.Token)
 			if err != nil {
-				p.message = "Failed to parse JWT token: " + err.Error()
-				vecty.Rerender(p)
+				p.Notifications.Notify(SeverityError, "Failed to parse JWT token: "+err.Error())
 				return
 			}
 
 			// Store token and user data
 			storeUserData(loginResp.Token, payload.UserID)
 
-			// Login successful
-			p.message = "Login successful!"
-			vecty.Rerender(p)
-
 			if p.OnLogin != nil {
 				p.OnLogin() // This will trigger navigation to /wplace
 			}
 		},
 		func(err string) {
-			p.message = "Login failed: " + err
-			vecty.Rerender(p)
+			p.Notifications.Notify(SeverityError, "Login failed: "+err)
 		},
 	)
 }
@@ -91,7 +84,6 @@ func (p *LoginPage) Render() vecty.ComponentOrHTML {
 				)),
 			),
 			elem.Button(vecty.Text("Login"), vecty.Markup(vecty.Property("type", "submit"))),
-			p.renderMessage(),
 		),
 		elem.Button(
 			vecty.Text("Don't have an account? Sign Up"),
@@ -101,10 +93,3 @@ func (p *LoginPage) Render() vecty.ComponentOrHTML {
 		),
 	)
 }
-
-func (p *LoginPage) renderMessage() vecty.ComponentOrHTML {
-	if p.message != "" {
-		return elem.Paragraph(vecty.Text(p.message))
-	}
-	return nil
-}
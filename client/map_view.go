@@ -7,10 +7,11 @@ import (
 	"io/ioutil"
 	"math"
 	"net/http"
-	"strconv"
-	"strings"
 	"syscall/js"
 
+	"ichthyo-cup-front/client/geometry"
+	"ichthyo-cup-front/client/projection"
+
 	"github.com/hexops/vecty"
 	"github.com/hexops/vecty/elem"
 	"github.com/hexops/vecty/event"
@@ -18,12 +19,8 @@ import (
 
 // Constants
 const (
-	minZoom       = 1
-	maxZoom       = 18
-	tileSize      = 256
+	tileSize      = projection.TileSize
 	zoomSpeed     = 0.01
-	cellGridSize  = 16 // Each tile is a 16x16 grid of cells
-	paintMinZoom  = 15 // Minimum zoom level to load/paint cells
 	selectionColor = "rgba(255, 0, 0, 0.5)" // Semi-transparent red for selection
 )
 
@@ -90,15 +87,88 @@ type IchthyoMapView struct {
 	lastDrag              Point
 	lastDragForClickCheck Point
 
-	SelectedCells map[string]SelectedCellInfo `vecty:"prop"`
+	SelectedCells map[cellRef]SelectedCellInfo `vecty:"prop"`
 	OnSelectionChange func() `vecty:"prop"` // Callback to trigger re-render of UIView
 	CurrentUserID string `vecty:"prop"` // The ID of the currently logged-in user
 	SelectedColor string `vecty:"prop"` // The currently selected color for painting
+	recentColors  []string // most recently chosen colors, newest first
+	TileSource    TileSource `vecty:"prop"` // Where base map tiles are loaded from
+	ShowGrid      bool       `vecty:"prop"` // Whether the cell grid overlay is drawn
+
+	PositionProvider PositionProvider `vecty:"prop"` // Used by LocateMe, the browser's Geolocation API when nil
+	location         *GeoPosition     // last located position, drawn by the location layer
+
+	hoverCell *cellRef // cell under the cursor, nil when outside paint zooms
+
+	Tool          Tool                                      `vecty:"prop"` // How clicks and drags edit the selection
+	OnColorPicked func(color, ownerID string)               `vecty:"prop"` // Called by the eyedropper; ownerID is set when asked for
+	OnInspect     func(c cellRef, clientX, clientY float64) `vecty:"prop"` // Called when a cell is clicked with the inspect tool
+	isStroking    bool                                      // a stroke tool is being dragged
+	strokeStart   cellRef                                   // cell the stroke started on
+	strokeLast    cellRef                                   // cell the stroke was last extended to
+	toolPreview   []cellRef                                 // line/rectangle shown while dragging
+	placing       *Pattern                                  // pattern following the cursor until a click places it
+
+	placingPreview placingPreview // cached cells of placing at the hovered anchor
+
+	Config     GameConfig `vecty:"prop"` // Game rules, see LoadGameConfig
+	Template   *Template  `vecty:"prop"` // Reference image drawn over the paint, nil when none
+	InkBalance int        `vecty:"prop"` // Ink the user can still spend, -1 when unknown
+
+	templateProgress templateProgress // cache of TemplateProgress
+	selectionVersion int              // bumped whenever SelectedCells changes
+	selectionCost    selectionCost    // cache of SelectionCost
+	selectionColors  selectionColors  // cache of normalizedSelection
+
+	OnInkChange    func()            `vecty:"prop"` // Called when InkBalance is updated
+	OnInkExceeded  func(skipped int) `vecty:"prop"` // Called when cells weren't selected for lack of ink
+	OnConfigChange func()            `vecty:"prop"` // Called when Config is replaced, e.g. a new palette
+
+	Notifications *NotificationCenter `vecty:"prop"` // Where player feedback is shown; printed to the console when nil
+
+	history    selectionHistory // undo/redo of SelectedCells edits
+	keyHandler js.Func
+
+	draftSaveScheduled bool
+	pendingDraft       *SelectionDraft // saved selection waiting for RestoreDraft/DiscardDraft
+	draftChanged       int             // cells of pendingDraft painted over since it was saved
+	draftCheckPending  bool            // checkDraft waits for the game config
 
-	paintCache map[string][]TileCell // key: z-x-y, value: cells for the tile
+	configLoaded bool // LoadGameConfig has finished, whether or not it succeeded
+
+	OnCursorChange func() `vecty:"prop"` // Called when the cursor moves over the map
+	hasCursor      bool
+	cursorLat      float64
+	cursorLng      float64
+	cursorCell     cellRef
+
+	paintCache   map[geometry.TileCoord][]TileCell // key: wrapped tile, value: cells for the tile
+	paintPending map[geometry.TileCoord][]func()   // tiles whose paint is being fetched, with the callbacks waiting for them
+	paintVersion int                               // bumped whenever paintCache changes
+
+	overviewCache      map[geometry.TileCoord]*overviewTile // key: wrapped tile, overview tiles below the paint zoom
+	overviewPending    map[geometry.TileCoord]bool          // overview tiles being fetched
+	overviewServerless bool                                 // the server has no overview endpoint, downsample locally
+
+	RecoveryButtons []InkRecoveryButton `vecty:"prop"` // Today's ink recovery buttons
+
+	viewListeners  []viewListener // called after every redraw, e.g. by the minimap
+	nextListenerID int
+
+	layers []Layer                         // bottom to top
+	tiles  map[geometry.TileCoord]*mapTile // currently displayed tiles, not wrapped
 
 	isRedrawScheduled bool
 	lastRedrawMs      int
+	drawnZoom         float64 // Zoom of the last DrawMap
+	isCommitting      bool    // a commit's POSTs are in flight
+
+	animSeq         int     // bumped to cancel the running animation
+	isFlying        bool    // a FlyTo animation is running
+	flyZoom         float64 // target zoom of the running FlyTo
+	wheelAnimating  bool    // wheel zoom is easing towards wheelTargetZoom
+	wheelTargetZoom float64
+	wheelAnchor     Point // cursor position the wheel zoom is anchored at
 }
 
 // NewIchthyoMapViewWithOptions creates a map view with explicit options.
@@ -106,16 +176,30 @@ func NewIchthyoMapViewWithOptions(onSelectionChange func(), userID string, selec
 	if onSelectionChange == nil {
 		onSelectionChange = func() {}
 	}
-	return &IchthyoMapView{
+	m := &IchthyoMapView{
 		CenterLat:         35.6762,
 		CenterLng:         139.6503,
 		Zoom:              16,
-		SelectedCells:     make(map[string]SelectedCellInfo),
+		SelectedCells:     make(map[cellRef]SelectedCellInfo),
 		OnSelectionChange: onSelectionChange,
 		CurrentUserID:     userID,
 		SelectedColor:     selectedColor,
-		paintCache:        make(map[string][]TileCell),
+		InkBalance:        -1,
+		Config:            defaultGameConfig(),
+		TileSource:        OSMTileSource,
+		paintCache:        make(map[geometry.TileCoord][]TileCell),
+		paintPending:      make(map[geometry.TileCoord][]func()),
+		overviewCache:     make(map[geometry.TileCoord]*overviewTile),
+		overviewPending:   make(map[geometry.TileCoord]bool),
+		tiles:             make(map[geometry.TileCoord]*mapTile),
+	}
+	if c, err := m.ValidateColor(selectedColor); err == nil {
+		m.SelectedColor = c
+	} else {
+		m.SelectedColor = m.Config.Palette[0]
 	}
+	m.layers = []Layer{&baseLayer{m}, &paintOverviewLayer{m}, &paintLayer{m}, &templateLayer{m}, &gridLayer{m}, &selectionLayer{m}, &toolPreviewLayer{m}, &patternPreviewLayer{m}, &hoverLayer{m}, &locationLayer{m}, &buttonLayer{m}}
+	return m
 }
 
 // NewIchthyoMapView provides a zero-arg constructor for existing call sites.
@@ -133,6 +217,15 @@ func (m *IchthyoMapView) Mount() {
 	style.Set("left", "0")
 	style.Set("will-change", "transform")
 
+	m.keyHandler = js.FuncOf(m.onKeyDown)
+	js.Global().Get("document").Call("addEventListener", "keydown", m.keyHandler)
+
+	m.checkDraftWhenReady()
+	if m.CurrentUserID == "" {
+		m.CurrentUserID = storedUserID()
+	}
+	m.LoadRecoveryButtons()
+
 	// ビューポート要素が確実にDOMに現れるまでリトライ
 	retries := 0
 	var attachFunc js.Func
@@ -159,6 +252,10 @@ func (m *IchthyoMapView) Unmount() {
 		m.tileContainer.Call("remove")
 	}
 	m.isMounted = false
+	m.draftCheckPending = false
+	m.resetTiles() // they were in tileContainer
+	js.Global().Get("document").Call("removeEventListener", "keydown", m.keyHandler)
+	m.keyHandler.Release()
 }
 
 func (m *IchthyoMapView) Render() vecty.ComponentOrHTML {
@@ -172,7 +269,7 @@ func (m *IchthyoMapView) Render() vecty.ComponentOrHTML {
 			event.MouseDown(m.onMouseDown),
 			event.MouseMove(m.onMouseMove),
 			event.MouseUp(m.onMouseUp),
-			event.MouseLeave(m.onMouseUp),
+			event.MouseLeave(m.onMouseLeave),
 			event.Wheel(m.onWheel),
 		),
 	)
@@ -188,53 +285,61 @@ func (m *IchthyoMapView) DrawMap() {
 	m.isRedrawScheduled = false
 	m.lastRedrawMs = js.Global().Get("Date").New().Call("getTime").Int()
 
-	m.tileContainer.Set("innerHTML", "")
-
-	screenWidth := js.Global().Get("innerWidth").Int()
-	screenHeight := js.Global().Get("innerHeight").Int()
-
-	baseZoom := int(math.Ceil(m.Zoom))
-	if baseZoom < minZoom {
-		baseZoom = minZoom
-	}
-	if baseZoom > maxZoom {
-		baseZoom = maxZoom
-	}
-
-	scale := math.Pow(2, m.Zoom-float64(baseZoom))
-
-	centerX, centerY := m.latLngToPixel(m.CenterLat, m.CenterLng, float64(baseZoom))
-
-	tx := centerX - (float64(screenWidth)/2)/scale
-	ty := centerY - (float64(screenHeight)/2)/scale
-
-	startTileX := int(math.Floor(tx / tileSize))
-	startTileY := int(math.Floor(ty / tileSize))
-
-	numTilesX := int(math.Ceil(float64(screenWidth)/(tileSize*scale))) + 1
-	numTilesY := int(math.Ceil(float64(screenHeight)/(tileSize*scale))) + 1
+	view := m.viewport()
 
 	containerStyle := m.tileContainer.Get("style")
-	containerStyle.Set("transform", fmt.Sprintf("scale(%.6f)", scale))
+	containerStyle.Set("transform", fmt.Sprintf("scale(%.6f)", view.Scale()))
 	containerStyle.Set("transform-origin", "top left")
 
-	for y := 0; y <= numTilesY; y++ {
-		for x := 0; x <= numTilesX; x++ {
-			tileX := startTileX + x
-			tileY := startTileY + y
+	// 見えているタイルは描き直さずに動かすだけ。グリッドの濃さはズームで変わる
+	zoomChanged := m.Zoom != m.drawnZoom
+	m.drawnZoom = m.Zoom
+	visible := make(map[geometry.TileCoord]bool)
+	for _, vt := range view.VisibleTiles() {
+		visible[vt.TileCoord] = true
+		t, ok := m.tiles[vt.TileCoord]
+		if !ok {
+			t = m.newMapTile(vt.Zoom, vt.X, vt.Y)
+			m.tiles[vt.TileCoord] = t
+			m.tileContainer.Call("appendChild", t.element)
+		}
+		t.moveTo(vt.Left, vt.Top)
+		if !ok {
+			m.drawTile(t)
+		} else if zoomChanged {
+			m.redrawLayerOnTile(layerGrid, t)
+		}
+	}
+	for key, t := range m.tiles {
+		if !visible[key] {
+			t.element.Call("remove")
+			delete(m.tiles, key)
+		}
+	}
 
-			canvas := js.Global().Get("document").Call("createElement", "canvas")
-			canvas.Set("id", fmt.Sprintf("tile-canvas-%d-%d-%d", baseZoom, tileX, tileY))
-			canvas.Set("width", tileSize)
-			canvas.Set("height", tileSize)
+	for _, l := range m.viewListeners {
+		l.fn()
+	}
+}
 
-			style := canvas.Get("style")
-			style.Set("position", "absolute")
-			style.Set("left", fmt.Sprintf("%.3fpx", float64(tileX*tileSize)-tx))
-			style.Set("top", fmt.Sprintf("%.3fpx", float64(tileY*tileSize)-ty))
+// viewListener is a function registered with AddViewListener.
+type viewListener struct {
+	id int
+	fn func()
+}
 
-			m.tileContainer.Call("appendChild", canvas)
-			m.drawTile(canvas, tileX, tileY, baseZoom, scale)
+// AddViewListener registers fn to be called whenever the map is redrawn.
+// Calling the returned function unregisters it, e.g. on Unmount.
+func (m *IchthyoMapView) AddViewListener(fn func()) (remove func()) {
+	m.nextListenerID++
+	id := m.nextListenerID
+	m.viewListeners = append(m.viewListeners, viewListener{id: id, fn: fn})
+	return func() {
+		for i, l := range m.viewListeners {
+			if l.id == id {
+				m.viewListeners = append(m.viewListeners[:i], m.viewListeners[i+1:]...)
+				return
+			}
 		}
 	}
 }
@@ -259,95 +364,83 @@ func (m *IchthyoMapView) scheduleDraw() {
 	}), delay)
 }
 
-func (m *IchthyoMapView) drawTile(canvas js.Value, tileX, tileY, zoom int, scale float64) {
-	ctx := canvas.Call("getContext", "2d")
-
-	// まずプレースホルダ背景
-	ctx.Set("fillStyle", "#f2f2f2")
-	ctx.Call("fillRect", 0, 0, tileSize, tileSize)
-
-	// すぐにキャッシュと選択を描画（タイル画像が遅れても見えるように）
-	m.drawCachedCellsForTile(ctx, zoom, tileX, tileY)
-	m.drawSelectionsForTile(ctx, tileX, tileY, scale)
-
-	// 背景タイル読み込み（成功時に下地として描く）
-	img := js.Global().Get("Image").New()
-	img.Set("src", m.getTileURL(tileX, tileY, zoom))
-
-	img.Call("addEventListener", "load", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		// 背景を先に描いて、その上に再度オーバーレイ
-		ctx.Call("drawImage", img, 0, 0)
-		m.drawCachedCellsForTile(ctx, zoom, tileX, tileY)
-		m.drawSelectionsForTile(ctx, tileX, tileY, scale)
-		return nil
-	}))
-
-	img.Call("addEventListener", "error", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		// タイル画像が読めなくてもキャッシュと選択は表示済み
-		return nil
-	}))
+// drawTile draws every layer of a tile, bottom to top.
+func (m *IchthyoMapView) drawTile(t *mapTile) {
+	for _, l := range m.layers {
+		m.drawLayerTile(l, t)
+	}
 }
 
-func (m *IchthyoMapView) fetchAndDrawCells(ctx js.Value, zoom, tileX, tileY int, scale float64) {
-	if zoom < paintMinZoom {
+// fetchPaintTile loads a tile's painted cells into paintCache and redraws its paint layer.
+// Tiles beyond the antimeridian are fetched as the tile they repeat.
+func (m *IchthyoMapView) fetchPaintTile(zoom, tileX, tileY int) {
+	key := geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}.Wrap()
+	if _, pending := m.paintPending[key]; pending || !key.Valid() {
 		return
 	}
+	m.paintPending[key] = nil
 
-	url := fmt.Sprintf("https://hack-s-ikuthio-2025.vercel.app/api/paint?zoom=%d&tile_x=%d&tile_y=%d", zoom, tileX, tileY)
+	url := fmt.Sprintf("%s/api/paint?zoom=%d&tile_x=%d&tile_y=%d", apiBaseURL, key.Zoom, key.X, key.Y)
 
 	getRequest(url, func(responseBody string) {
-		var data PaintGetResponse
-		if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+		waiting := m.paintPending[key]
+		delete(m.paintPending, key)
+		if err := m.storePaintTile(key.Zoom, key.X, key.Y, responseBody); err != nil {
 			fmt.Println("Failed to unmarshal paint data:", err)
-			return
 		}
-
-		// Update cache
-		key := m.tileKey(zoom, tileX, tileY)
-		m.paintCache[key] = data.Cells
-
-		// Fixed cell pixel size regardless of zoom scale
-		cellPixelSize := float64(tileSize) / float64(cellGridSize)
-
-		for _, cell := range data.Cells {
-			ctx.Set("fillStyle", cell.Color)
-			ctx.Call("fillRect", float64(cell.CellX)*cellPixelSize, float64(cell.CellY)*cellPixelSize, cellPixelSize, cellPixelSize)
+		for _, done := range waiting {
+			done()
 		}
-
-		m.drawSelectionsForTile(ctx, tileX, tileY, scale)
-
 	}, func(errText string) {
+		waiting := m.paintPending[key]
+		delete(m.paintPending, key)
 		fmt.Println("Failed to fetch paint data:", errText)
+		for _, done := range waiting {
+			done()
+		}
 	})
 }
 
-func (m *IchthyoMapView) drawCachedCellsForTile(ctx js.Value, zoom, tileX, tileY int) {
-	cells, ok := m.paintCache[m.tileKey(zoom, tileX, tileY)]
-	if !ok {
+// whenPaintLoaded calls done once the tile's paint is in paintCache or failed
+// to load. key must be wrapped.
+func (m *IchthyoMapView) whenPaintLoaded(key geometry.TileCoord, done func()) {
+	if _, ok := m.paintCache[key]; ok || !key.Valid() {
+		done()
 		return
 	}
-	cellPixelSize := float64(tileSize) / float64(cellGridSize)
-	for _, cell := range cells {
-		ctx.Set("fillStyle", cell.Color)
-		ctx.Call("fillRect", float64(cell.CellX)*cellPixelSize, float64(cell.CellY)*cellPixelSize, cellPixelSize, cellPixelSize)
-	}
+	m.fetchPaintTile(key.Zoom, key.X, key.Y)
+	m.paintPending[key] = append(m.paintPending[key], done)
 }
 
-func (m *IchthyoMapView) drawSelectionsForTile(ctx js.Value, tileX, tileY int, scale float64) {
-	cellPixelSize := float64(tileSize) / float64(cellGridSize)
-	
-	for _, selection := range m.SelectedCells {
-		if selection.TileX == tileX && selection.TileY == tileY {
-			ctx.Set("fillStyle", selection.Payload.Color)
-			ctx.Call("fillRect", float64(selection.Payload.CellX)*cellPixelSize, float64(selection.Payload.CellY)*cellPixelSize, cellPixelSize, cellPixelSize)
-		}
+// storePaintTile caches a GET /api/paint response and redraws the tile.
+func (m *IchthyoMapView) storePaintTile(zoom, tileX, tileY int, responseBody string) error {
+	var data PaintGetResponse
+	if err := json.Unmarshal([]byte(responseBody), &data); err != nil {
+		return err
+	}
+
+	// Update cache
+	key := geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}.Wrap()
+	m.paintCache[key] = data.Cells
+	m.paintVersion++
+	m.RedrawLayerArea(layerPaint, zoom, tileX, tileY)
+	// 上位ズームの概観は、このタイルを含むものだけ描き直す
+	if zoom == m.Config.PaintZoom && m.invalidateOverview(key, false) {
+		m.RedrawLayerArea(layerOverview, key.Zoom, key.X, key.Y)
 	}
+	return nil
 }
 
 // --- Event Handlers & Painting Logic ---
 
 func (m *IchthyoMapView) onMouseDown(e *vecty.Event) {
 	e.Call("preventDefault")
+	m.stopAnimation()
+	// パターン配置中はクリックで置くので、ストロークは始めない
+	if m.placing == nil && m.Tool.isStrokeTool() && int(math.Ceil(m.Zoom)) >= m.Config.PaintZoom {
+		m.beginStroke(e)
+		return
+	}
 	m.isDragging = true
 	pos := Point{X: e.Get("clientX").Int(), Y: e.Get("clientY").Int()}
 	m.dragStart = pos
@@ -357,7 +450,14 @@ func (m *IchthyoMapView) onMouseDown(e *vecty.Event) {
 }
 
 func (m *IchthyoMapView) onMouseMove(e *vecty.Event) {
+	if m.isStroking {
+		e.Call("preventDefault")
+		m.updateHover(e)
+		m.continueStroke(e)
+		return
+	}
 	if !m.isDragging {
+		m.updateHover(e)
 		return
 	}
 	e.Call("preventDefault")
@@ -367,18 +467,20 @@ func (m *IchthyoMapView) onMouseMove(e *vecty.Event) {
 	dx := float64(m.lastDrag.X - currentPos.X)
 	dy := float64(m.lastDrag.Y - currentPos.Y)
 
-	scale := math.Pow(2, m.Zoom)
-	lngPerPixel := 360.0 / (scale * tileSize)
-	latPerPixel := 180.0 / (scale * tileSize)
-
-	m.CenterLng += dx * lngPerPixel
-	m.CenterLat -= dy * latPerPixel
+	// 画面の1pxは表示中のズームのワールド座標の1px。メルカトルのまま動かす
+	cx, cy := projection.LatLngToWorld(m.CenterLat, m.CenterLng, m.Zoom)
+	worldSize := math.Pow(2, m.Zoom) * tileSize
+	m.CenterLat, m.CenterLng = projection.WorldToLatLng(cx+dx, math.Min(math.Max(cy+dy, 0), worldSize), m.Zoom)
 
 	m.lastDrag = currentPos
 	m.scheduleDraw()
 }
 
 func (m *IchthyoMapView) onMouseUp(e *vecty.Event) {
+	if m.isStroking {
+		m.endStroke()
+		return
+	}
 	if !m.isDragging {
 		return
 	}
@@ -393,188 +495,328 @@ func (m *IchthyoMapView) onMouseUp(e *vecty.Event) {
 	}
 }
 
-func (m *IchthyoMapView) handleClick(e *vecty.Event) {
-	baseZoom := int(math.Ceil(m.Zoom))
-	if baseZoom < paintMinZoom {
-		fmt.Println("Zoom in further to paint!")
-		return
+func (m *IchthyoMapView) onMouseLeave(e *vecty.Event) {
+	// カーソル位置は最後の値を残す（読み取り欄をクリックできるように）
+	m.setHoverCell(nil)
+	m.onMouseUp(e)
+}
+
+func (m *IchthyoMapView) updateHover(e *vecty.Event) {
+	x, y := e.Get("clientX").Float(), e.Get("clientY").Float()
+	c := m.cellAt(x, y)
+	paintable := int(math.Ceil(m.Zoom)) >= m.Config.PaintZoom
+
+	m.hasCursor = true
+	m.cursorLat, m.cursorLng = m.viewport().ScreenToLatLng(x, y)
+	m.cursorCell = c
+	if m.OnCursorChange != nil {
+		m.OnCursorChange()
 	}
 
-	cursorX := e.Get("clientX").Float()
-	cursorY := e.Get("clientY").Float()
+	if !paintable {
+		m.setHoverCell(nil)
+		return
+	}
+	m.setHoverCell(&c)
+}
 
-	lat, lng := m.pixelToLatLng(cursorX, cursorY, m.Zoom)
-	worldX, worldY := m.latLngToPixel(lat, lng, float64(baseZoom))
+// CursorPosition returns the lat/lng and cell under the cursor, if it is over the map.
+func (m *IchthyoMapView) CursorPosition() (lat, lng float64, cell cellRef, ok bool) {
+	return m.cursorLat, m.cursorLng, m.cursorCell, m.hasCursor
+}
 
-	tileX := int(math.Floor(worldX / tileSize))
-	tileY := int(math.Floor(worldY / tileSize))
+// CellOwner returns the ID of the user who painted a cell, from paintCache.
+func (m *IchthyoMapView) CellOwner(c cellRef) (string, bool) {
+	for _, cell := range m.paintCache[c.Tile().Wrap()] {
+		if cell.CellX == c.CellX && cell.CellY == c.CellY {
+			return cell.UserID, true
+		}
+	}
+	return "", false
+}
 
-	cellPixelSize := float64(tileSize) / float64(cellGridSize)
-	cellX := int(math.Floor(math.Mod(worldX, tileSize) / cellPixelSize))
-	cellY := int(math.Floor(math.Mod(worldY, tileSize) / cellPixelSize))
+func (m *IchthyoMapView) handleClick(e *vecty.Event) {
+	baseZoom := int(math.Ceil(m.Zoom))
+	if baseZoom < m.Config.PaintZoom {
+		m.Notifications.Notify(SeverityInfo, "Zoom in further to paint!")
+		return
+	}
 
-	cellKey := fmt.Sprintf("%d-%d-%d-%d", tileX, tileY, cellX, cellY)
-	wasSelected := false
-	if _, exists := m.SelectedCells[cellKey]; exists {
-		delete(m.SelectedCells, cellKey)
-		wasSelected = true
-	} else {
-		color := m.SelectedColor // Use the selected color from the UI
-		m.SelectedCells[cellKey] = SelectedCellInfo{
-			TileX: tileX,
-			TileY: tileY,
-			Payload: PaintCellPayload{CellX: cellX, CellY: cellY, Color: color},
+	c := m.cellAt(e.Get("clientX").Float(), e.Get("clientY").Float())
+	if m.placing != nil {
+		m.placePattern(c)
+		return
+	}
+	switch m.Tool {
+	case ToolFill:
+		m.fill(c)
+		return
+	case ToolEyedropper:
+		m.pickColor(c, e.Get("altKey").Bool() || e.Get("shiftKey").Bool())
+		return
+	case ToolInspect:
+		if m.OnInspect != nil {
+			m.OnInspect(c, e.Get("clientX").Float(), e.Get("clientY").Float())
 		}
+		return
 	}
+	tileX, tileY, cellX, cellY := c.TileX, c.TileY, c.CellX, c.CellY
 
-	canvasID := fmt.Sprintf("tile-canvas-%d-%d-%d", baseZoom, tileX, tileY)
-	canvas := js.Global().Get("document").Call("getElementById", canvasID)
-	if !canvas.IsUndefined() && !canvas.IsNull() {
-		scale := math.Pow(2, m.Zoom-float64(baseZoom))
-		
-		// Draw selection immediately on the canvas
-		ctx := canvas.Call("getContext", "2d")
-		cellPixelSize := float64(tileSize) / float64(cellGridSize)
-		
-		if wasSelected {
-			// Clear and redraw the tile when deselecting
-			ctx.Call("clearRect", 0, 0, tileSize, tileSize)
-			// Redraw the background tile
-			img := js.Global().Get("Image").New()
-			img.Set("crossOrigin", "anonymous")
-			img.Set("src", m.getTileURL(tileX, tileY, baseZoom))
-			img.Call("addEventListener", "load", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-				ctx.Call("drawImage", img, 0, 0)
-				m.drawSelectionsForTile(ctx, tileX, tileY, scale)
-				return nil
-			}))
-		} else {
-			// Draw the new selection immediately with the selected color
-			ctx.Set("fillStyle", m.SelectedColor)
-			ctx.Call("fillRect", float64(cellX)*cellPixelSize, float64(cellY)*cellPixelSize, cellPixelSize, cellPixelSize)
+	if _, exists := m.SelectedCells[c]; exists {
+		m.edit("Deselect", func() {
+			m.setSelected(c, nil)
+		})
+	} else {
+		color, err := m.ValidateColor(m.SelectedColor) // Use the selected color from the UI
+		if err != nil {
+			m.Notifications.Notify(SeverityError, err.Error())
+			return
+		}
+		if left := m.inkLeft(); left >= 0 && left < m.cellCost(c) {
+			m.inkExceeded(1)
+			return
 		}
+		m.edit("Select", func() {
+			m.setSelected(c, &SelectedCellInfo{
+				TileX:   tileX,
+				TileY:   tileY,
+				Payload: PaintCellPayload{CellX: cellX, CellY: cellY, Color: color},
+			})
+		})
 	}
+
+	// 選択レイヤーだけを再描画
+	m.RedrawLayerArea(layerSelection, c.Zoom, tileX, tileY)
 	if m.OnSelectionChange != nil {
 		m.OnSelectionChange()
 	}
 }
 
+// selectionColors is the last result of normalizedSelection.
+type selectionColors struct {
+	selectionVersion int
+	cells            map[cellRef]string
+}
+
+// normalizedSelection returns the selected cells with their palette colors.
+// Cells are already canonical (see toCanonical); colors outside the palette
+// are skipped. The map is cached until the selection changes, so callers must
+// not modify it.
+func (m *IchthyoMapView) normalizedSelection() map[cellRef]string {
+	if m.selectionColors.cells != nil && m.selectionColors.selectionVersion == m.selectionVersion {
+		return m.selectionColors.cells
+	}
+	cells := make(map[cellRef]string, len(m.SelectedCells))
+	for c, selection := range m.SelectedCells {
+		if color, err := m.ValidateColor(selection.Payload.Color); err == nil {
+			cells[c] = color
+		}
+	}
+	m.selectionColors.cells = cells
+	m.selectionColors.selectionVersion = m.selectionVersion
+	return cells
+}
+
 func (m *IchthyoMapView) CommitSelection() {
 	if len(m.SelectedCells) == 0 {
 		return
 	}
+	if m.isCommitting {
+		m.Notifications.Notify(SeverityInfo, "Still painting the last selection, wait a moment.")
+		return
+	}
 
-	baseZoom := int(math.Ceil(m.Zoom))
 	userID := m.CurrentUserID // Use the actual user ID
 
 	if userID == "" {
-		fmt.Println("Error: User not logged in. Cannot paint.")
+		m.Notifications.Notify(SeverityError, "You are not logged in, log in to paint.", ToastAction{Label: "Log in", Do: func() {
+			js.Global().Get("location").Set("hash", "#/login")
+		}})
+		return
+	}
+
+	if m.OverBudget() {
+		m.Notifications.Notify(SeverityWarning, fmt.Sprintf("Not enough ink: the selection needs %d, you have %d.", m.SelectionCost(), m.InkBalance))
+		m.inkExceeded(m.SelectionCost() - m.InkBalance)
 		return
 	}
 
-	groups := make(map[string][]PaintCellPayload)
-	for _, selection := range m.SelectedCells {
-		tileKey := fmt.Sprintf("%d-%d", selection.TileX, selection.TileY)
-		groups[tileKey] = append(groups[tileKey], selection.Payload)
+	selection := m.normalizedSelection()
+	if m.OverCommitLimit() {
+		m.Notifications.Notify(SeverityWarning, fmt.Sprintf("Too many cells: at most %d can be painted at once, the selection has %d.", m.Config.MaxCellsPerCommit, len(selection)))
+		return
 	}
 
-	for tileKey, cells := range groups {
-		parts := strings.Split(tileKey, "-")
-		tileX, _ := strconv.Atoi(parts[0])
-		tileY, _ := strconv.Atoi(parts[1])
+	// 日付変更線を越えたセルは元のタイルとして送る
+	groups := make(map[geometry.TileCoord][]PaintCellPayload)
+	for c, color := range selection {
+		tile := c.Tile().Wrap()
+		groups[tile] = append(groups[tile], PaintCellPayload{CellX: c.CellX, CellY: c.CellY, Color: color})
+	}
 
+	var requests []paintRequest
+	for tile, cells := range groups {
 		payload := PaintPostRequest{
 			UserID: userID,
-			Zoom:   baseZoom,
-			TileX:  tileX,
-			TileY:  tileY,
+			Zoom:   tile.Zoom,
+			TileX:  tile.X,
+			TileY:  tile.Y,
 			Cells:  cells,
 		}
 
 		requestBody, err := json.Marshal(payload)
 		if err != nil {
-			fmt.Printf("Failed to create paint request for tile %s: %v\n", tileKey, err)
+			m.Notifications.Notify(SeverityError, fmt.Sprintf("Failed to create paint request for tile %s: %v", tile, err))
 			continue
 		}
-
-		postRequest("https://hack-s-ikuthio-2025.vercel.app/api/paint", requestBody, func(responseBody string) {
-			fmt.Printf("Paint successful for tile %s: %s\n", tileKey, responseBody)
-		}, func(errText string) {
-			fmt.Printf("Paint failed for tile %s: %s\n", tileKey, errText)
-		})
+		requests = append(requests, paintRequest{tile: tile, body: requestBody, cells: len(cells)})
 	}
+	// 送信中にページを閉じても選択が残るよう、成功するまで下書きは消さない
+	m.saveDraft()
+	m.postPaint(requests, func() { m.clearCommitted(selection) })
+}
 
-	m.SelectedCells = make(map[string]SelectedCellInfo)
-	m.DrawMap()
+// clearCommitted removes the painted cells from the selection, and from the
+// saved draft, once the whole commit went through. Cells changed while it was
+// being sent stay selected.
+func (m *IchthyoMapView) clearCommitted(committed map[cellRef]string) {
+	for c, color := range committed {
+		info, ok := m.SelectedCells[c]
+		if !ok {
+			continue
+		}
+		if cur, err := m.ValidateColor(info.Payload.Color); err == nil && cur == color {
+			delete(m.SelectedCells, c)
+		}
+	}
+	m.selectionVersion++
+	m.ResetHistory()
+	m.saveDraft()
+	m.RedrawLayer(layerSelection)
 	if m.OnSelectionChange != nil {
 		m.OnSelectionChange()
 	}
 }
 
+// paintRequest is the POST /api/paint request of one tile of a commit.
+type paintRequest struct {
+	tile  geometry.TileCoord
+	body  []byte
+	cells int
+}
+
+// postPaint sends the requests of a commit and reports the result in one
+// toast. Tiles that failed can be sent again from it. onSuccess is called
+// once every tile has been painted, after a retry if need be.
+func (m *IchthyoMapView) postPaint(requests []paintRequest, onSuccess func()) {
+	if len(requests) == 0 {
+		return
+	}
+	m.isCommitting = true
+	remaining, painted := len(requests), 0
+	ink := -1 // lowest balance reported by the responses
+	var failed []paintRequest
+	var lastErr string
+	done := func() {
+		remaining--
+		if remaining > 0 {
+			return
+		}
+		m.isCommitting = false
+		// レスポンスの順番は保証されないので、インクは最後にまとめて反映する
+		if ink >= 0 && len(failed) == 0 {
+			m.setInkBalance(ink)
+		} else {
+			m.RefreshInk()
+		}
+		if len(failed) == 0 {
+			m.Notifications.Notify(SeveritySuccess, fmt.Sprintf("Painted %d cells", painted))
+			if onSuccess != nil {
+				onSuccess()
+			}
+			return
+		}
+		retry := failed
+		msg := "Paint failed: " + lastErr
+		if len(failed) < len(requests) {
+			msg = fmt.Sprintf("Painted %d cells, but %d of %d tiles failed: %s", painted, len(failed), len(requests), lastErr)
+		}
+		m.Notifications.Notify(SeverityError, msg, ToastAction{Label: "Retry", Do: func() { m.postPaint(retry, onSuccess) }})
+	}
+
+	for _, r := range requests {
+		r := r
+		postRequest(apiBaseURL+"/api/paint", r.body, func(responseBody string) {
+			painted += r.cells
+			// Drop the cached paint so the layer refetches it
+			delete(m.paintCache, r.tile)
+			m.paintVersion++
+			if m.invalidateOverview(r.tile, true) {
+				m.RedrawLayerArea(layerOverview, r.tile.Zoom, r.tile.X, r.tile.Y)
+			}
+			m.RedrawLayerArea(layerPaint, r.tile.Zoom, r.tile.X, r.tile.Y)
+			if left, ok := remainingInk(responseBody); ok && (ink < 0 || left < ink) {
+				ink = left
+			}
+			done()
+		}, func(errText string) {
+			fmt.Printf("Paint failed for tile %s: %s\n", r.tile, errText)
+			failed = append(failed, r)
+			lastErr = errText
+			done()
+		})
+	}
+}
+
 func (m *IchthyoMapView) onWheel(e *vecty.Event) {
 	e.Call("preventDefault")
 
 	cursorX := e.Get("clientX").Float()
 	cursorY := e.Get("clientY").Float()
 
-	lat1, lng1 := m.pixelToLatLng(cursorX, cursorY, m.Zoom)
-
 	delta := e.Get("deltaY").Float()
-	m.Zoom -= delta * zoomSpeed
-	if m.Zoom < minZoom {
-		m.Zoom = minZoom
-	}
-	if m.Zoom > maxZoom {
-		m.Zoom = maxZoom
-	}
-
-	lat2, lng2 := m.pixelToLatLng(cursorX, cursorY, m.Zoom)
-
-	m.CenterLat += lat1 - lat2
-	m.CenterLng += lng1 - lng2
-
-	m.scheduleDraw()
+	m.zoomWheel(cursorX, cursorY, -delta*zoomSpeed)
 }
 
 // --- Coordinate Conversion & Helpers ---
 
-func (m *IchthyoMapView) latLngToPixel(lat, lng, zoom float64) (float64, float64) {
-	latRad := lat * math.Pi / 180.0
-	n := math.Pow(2.0, zoom)
-	x := (lng + 180.0) / 360.0 * n * tileSize
-	y := (1.0 - math.Asinh(math.Tan(latRad))/math.Pi) / 2.0 * n * tileSize
-	return x, y
-}
-
-func (m *IchthyoMapView) pixelToLatLng(px, py, zoom float64) (float64, float64) {
-	screenWidth := js.Global().Get("innerWidth").Float()
-	screenHeight := js.Global().Get("innerHeight").Float()
-
-	baseZoom := int(math.Ceil(zoom))
-	scale := math.Pow(2, zoom-float64(baseZoom))
-
-	centerX, centerY := m.latLngToPixel(m.CenterLat, m.CenterLng, float64(baseZoom))
-
-	tx := centerX - (screenWidth/2)/scale
-	ty := centerY - (screenHeight/2)/scale
-
-	worldX := (px / scale) + tx
-	worldY := (py / scale) + ty
-
-	n := math.Pow(2.0, float64(baseZoom))
-	lng := (worldX/tileSize)/n*360.0 - 180.0
-	latRad := math.Atan(math.Sinh(math.Pi * (1.0 - 2.0*worldY/(n*tileSize))))
-	lat := latRad * 180.0 / math.Pi
-	return lat, lng
+// viewport returns the current view of the map on the browser window.
+func (m *IchthyoMapView) viewport() projection.Viewport {
+	return projection.Viewport{
+		CenterLat: m.CenterLat,
+		CenterLng: m.CenterLng,
+		Zoom:      m.Zoom,
+		Width:     js.Global().Get("innerWidth").Float(),
+		Height:    js.Global().Get("innerHeight").Float(),
+	}
 }
 
-func (m *IchthyoMapView) getTileURL(x, y, z int) string {
-	// Nginxの/tiles/経由でOSMにプロキシ（CORS回避）
-	return fmt.Sprintf("/tiles/%d/%d/%d.png", z, x, y)
+// SetTileSource switches the base map and redraws.
+func (m *IchthyoMapView) SetTileSource(src TileSource) {
+	if src == nil {
+		src = NoTileSource
+	}
+	m.TileSource = src
+	m.redrawAll()
 }
 
-func (m *IchthyoMapView) tileKey(zoom, tileX, tileY int) string {
-	return fmt.Sprintf("%d-%d-%d", zoom, tileX, tileY)
+// baseTileFor returns the image URL for a map tile and the source rectangle to draw from it.
+// Above the source's max zoom the parent tile is scaled up (overzoom).
+func (m *IchthyoMapView) baseTileFor(x, y, z int) (url string, sx, sy, sw float64) {
+	src := m.TileSource
+	if src == nil || z < src.MinZoom() || y < 0 || y >= 1<<uint(z) {
+		return "", 0, 0, 0
+	}
+	size := float64(src.TileSize())
+	dz := z - src.MaxZoom()
+	if dz <= 0 {
+		return tileSourceURL(src, x, y, z), 0, 0, size
+	}
+	f := 1 << uint(dz)
+	px := int(math.Floor(float64(x) / float64(f)))
+	py := int(math.Floor(float64(y) / float64(f)))
+	sw = size / float64(f)
+	return tileSourceURL(src, px, py, src.MaxZoom()), float64(x-px*f) * sw, float64(y-py*f) * sw, sw
 }
 
 // --- HTTP Helpers ---
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"math"
+	"syscall/js"
+	"time"
+
+	"ichthyo-cup-front/client/projection"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const (
+	minimapWidth      = 200
+	minimapHeight     = 150
+	minimapZoomOffset = 5 // how many zoom levels the minimap sits below the main map
+	minimapFlyTime    = 300 * time.Millisecond
+	minimapDragStart  = 3 // px the mouse must move before a press becomes a drag
+)
+
+// Minimap shows a low-zoom overview of the map around IchthyoMapView's viewport.
+// Clicking flies the main map there, dragging pans it.
+type Minimap struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	canvas             js.Value
+	images             map[string]js.Value // base tile images by URL
+	removeViewListener func()
+
+	isPressed  bool
+	isDragging bool  // the press moved far enough to pan instead of fly
+	pressPos   Point // where the press started
+	lastDrag   Point
+}
+
+// NewMinimap creates a minimap following mapView.
+func NewMinimap(mapView *IchthyoMapView) *Minimap {
+	return &Minimap{
+		MapView: mapView,
+		images:  make(map[string]js.Value),
+	}
+}
+
+func (mm *Minimap) Mount() {
+	mm.canvas = js.Global().Get("document").Call("querySelector", ".minimap-canvas")
+	mm.removeViewListener = mm.MapView.AddViewListener(mm.Draw)
+	mm.Draw()
+}
+
+func (mm *Minimap) Unmount() {
+	if mm.removeViewListener != nil {
+		mm.removeViewListener()
+		mm.removeViewListener = nil
+	}
+	mm.canvas = js.Undefined()
+}
+
+func (mm *Minimap) Render() vecty.ComponentOrHTML {
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("bottom", "20px"), vecty.Style("left", "20px"), vecty.Style("border", "2px solid rgba(0,0,0,0.7)"), vecty.Style("background", "#f2f2f2"), vecty.Style("zIndex", "1001")),
+		elem.Canvas(
+			vecty.Markup(
+				vecty.Class("minimap-canvas"),
+				vecty.Attribute("width", minimapWidth),
+				vecty.Attribute("height", minimapHeight),
+				vecty.Style("display", "block"),
+				vecty.Style("cursor", "pointer"),
+				event.MouseDown(mm.onMouseDown),
+				event.MouseMove(mm.onMouseMove),
+				event.MouseUp(mm.onMouseUp),
+				event.MouseLeave(mm.onMouseLeave),
+			),
+		),
+	)
+}
+
+// zoom returns the minimap's integer zoom level.
+func (mm *Minimap) zoom() int {
+	return int(mm.MapView.clampZoom(math.Floor(mm.MapView.Zoom) - minimapZoomOffset))
+}
+
+// origin returns the world pixel at the minimap's top-left corner.
+func (mm *Minimap) origin(zoom int) (float64, float64) {
+	cx, cy := projection.LatLngToWorld(mm.MapView.CenterLat, mm.MapView.CenterLng, float64(zoom))
+	return cx - minimapWidth/2, cy - minimapHeight/2
+}
+
+// Draw redraws the base tiles, the paint overview and the viewport rectangle.
+func (mm *Minimap) Draw() {
+	if mm.canvas.IsUndefined() || mm.canvas.IsNull() {
+		return
+	}
+	m := mm.MapView
+	ctx := mm.canvas.Call("getContext", "2d")
+	ctx.Set("fillStyle", "#f2f2f2")
+	ctx.Call("fillRect", 0, 0, minimapWidth, minimapHeight)
+
+	zoom := mm.zoom()
+	ox, oy := mm.origin(zoom)
+	startX := int(math.Floor(ox / tileSize))
+	startY := int(math.Floor(oy / tileSize))
+	endX := int(math.Floor((ox + minimapWidth) / tileSize))
+	endY := int(math.Floor((oy + minimapHeight) / tileSize))
+
+	for y := startY; y <= endY; y++ {
+		for x := startX; x <= endX; x++ {
+			left := float64(x*tileSize) - ox
+			top := float64(y*tileSize) - oy
+
+			url, sx, sy, sw := m.baseTileFor(x, y, zoom)
+			if url != "" {
+				img := mm.image(url)
+				if img.Get("complete").Bool() && img.Get("naturalWidth").Int() > 0 {
+					ctx.Call("drawImage", img, sx, sy, sw, sw, left, top, tileSize, tileSize)
+				}
+			}
+			if zoom < m.Config.PaintZoom {
+				if ov := m.overviewFor(zoom, x, y); ov != nil {
+					drawOverviewTile(ctx, ov, left, top, tileSize)
+				}
+			}
+		}
+	}
+
+	// メインビューの範囲を四角で表示
+	view := m.viewport()
+	lat1, lng1 := view.ScreenToLatLng(0, 0)
+	lat2, lng2 := view.ScreenToLatLng(view.Width, view.Height)
+	x1, y1 := projection.LatLngToWorld(lat1, lng1, float64(zoom))
+	x2, y2 := projection.LatLngToWorld(lat2, lng2, float64(zoom))
+	ctx.Set("strokeStyle", "#ff0000")
+	ctx.Set("lineWidth", 2)
+	ctx.Call("strokeRect", x1-ox, y1-oy, math.Max(x2-x1, 2), math.Max(y2-y1, 2))
+}
+
+// image returns the cached image for url, loading it on first use.
+func (mm *Minimap) image(url string) js.Value {
+	if img, ok := mm.images[url]; ok {
+		return img
+	}
+	img := js.Global().Get("Image").New()
+	img.Call("addEventListener", "load", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		mm.Draw()
+		return nil
+	}))
+	img.Set("src", url)
+	mm.images[url] = img
+	return img
+}
+
+func (mm *Minimap) onMouseDown(e *vecty.Event) {
+	e.Call("preventDefault")
+	mm.isPressed = true
+	mm.isDragging = false
+	mm.pressPos = Point{X: e.Get("offsetX").Int(), Y: e.Get("offsetY").Int()}
+	mm.lastDrag = mm.pressPos
+}
+
+func (mm *Minimap) onMouseMove(e *vecty.Event) {
+	if !mm.isPressed {
+		return
+	}
+	e.Call("preventDefault")
+	pos := Point{X: e.Get("offsetX").Int(), Y: e.Get("offsetY").Int()}
+	if !mm.isDragging {
+		dx := math.Abs(float64(pos.X - mm.pressPos.X))
+		dy := math.Abs(float64(pos.Y - mm.pressPos.Y))
+		if dx < minimapDragStart && dy < minimapDragStart {
+			return
+		}
+		mm.isDragging = true
+	}
+	dx := float64(pos.X - mm.lastDrag.X)
+	dy := float64(pos.Y - mm.lastDrag.Y)
+	mm.lastDrag = pos
+	if dx == 0 && dy == 0 {
+		return
+	}
+
+	// ミニマップ上の移動量をそのままメインの中心に反映
+	m := mm.MapView
+	m.stopAnimation()
+	zoom := float64(mm.zoom())
+	cx, cy := projection.LatLngToWorld(m.CenterLat, m.CenterLng, zoom)
+	m.CenterLat, m.CenterLng = projection.WorldToLatLng(cx+dx, cy+dy, zoom)
+	m.scheduleDraw()
+}
+
+// onMouseUp flies to the clicked point, unless the press was a drag.
+func (mm *Minimap) onMouseUp(e *vecty.Event) {
+	wasClick := mm.isPressed && !mm.isDragging
+	mm.isPressed, mm.isDragging = false, false
+	if !wasClick {
+		return
+	}
+
+	// クリック位置へ移動
+	zoom := mm.zoom()
+	ox, oy := mm.origin(zoom)
+	px, py := e.Get("offsetX").Float(), e.Get("offsetY").Float()
+	lat, lng := projection.WorldToLatLng(ox+px, oy+py, float64(zoom))
+	mm.MapView.FlyTo(lat, lng, mm.MapView.Zoom, minimapFlyTime)
+}
+
+func (mm *Minimap) onMouseLeave(e *vecty.Event) {
+	mm.isPressed, mm.isDragging = false, false
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const maxToasts = 5 // oldest toasts are dropped beyond this
+
+// Severity is how important a toast is. It picks the color and how long the
+// toast stays up.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeveritySuccess
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeveritySuccess:
+		return "success"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "info"
+}
+
+func (s Severity) color() string {
+	switch s {
+	case SeveritySuccess:
+		return "#4caf50"
+	case SeverityWarning:
+		return "#ffa500"
+	case SeverityError:
+		return "#ff6b6b"
+	}
+	return "#64b5f6"
+}
+
+// timeout is how long a toast of this severity stays up, in ms.
+func (s Severity) timeout() int {
+	switch s {
+	case SeverityWarning:
+		return 6000
+	case SeverityError:
+		return 8000
+	}
+	return 4000
+}
+
+// ToastAction is a button on a toast. Clicking it dismisses the toast and runs Do.
+type ToastAction struct {
+	Label string
+	Do    func()
+}
+
+// Toast is one notification.
+type Toast struct {
+	ID       int
+	Severity Severity
+	Message  string
+	Actions  []ToastAction
+}
+
+// NotificationCenter shows toasts at the bottom center of the page. Toasts are
+// dismissed after a while, except ones with actions, which wait for the user.
+type NotificationCenter struct {
+	vecty.Core
+
+	toasts    []Toast // oldest first
+	nextID    int
+	isMounted bool
+}
+
+// NewNotificationCenter creates an empty notification center.
+func NewNotificationCenter() *NotificationCenter {
+	return &NotificationCenter{}
+}
+
+// Notify shows a toast and returns its ID. On a nil center the message is
+// only printed to the console, and while the center isn't on the page it is
+// printed as well, so it isn't lost if the page never shows the center.
+func (n *NotificationCenter) Notify(severity Severity, message string, actions ...ToastAction) int {
+	if n == nil {
+		fmt.Printf("[%s] %s\n", severity, message)
+		return 0
+	}
+	if !n.isMounted {
+		fmt.Printf("[%s] %s\n", severity, message)
+	}
+	n.nextID++
+	t := Toast{ID: n.nextID, Severity: severity, Message: message, Actions: actions}
+	n.toasts = append(n.toasts, t)
+	if len(n.toasts) > maxToasts {
+		n.toasts = n.toasts[len(n.toasts)-maxToasts:]
+	}
+	if len(actions) == 0 {
+		var dismiss js.Func
+		dismiss = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			dismiss.Release()
+			n.Dismiss(t.ID)
+			return nil
+		})
+		js.Global().Call("setTimeout", dismiss, severity.timeout())
+	}
+	n.rerender()
+	return t.ID
+}
+
+// Dismiss removes a toast, if it is still shown.
+func (n *NotificationCenter) Dismiss(id int) {
+	if n == nil {
+		return
+	}
+	for i, t := range n.toasts {
+		if t.ID == id {
+			n.toasts = append(n.toasts[:i], n.toasts[i+1:]...)
+			n.rerender()
+			return
+		}
+	}
+}
+
+func (n *NotificationCenter) Mount() {
+	n.isMounted = true
+}
+
+func (n *NotificationCenter) Unmount() {
+	n.isMounted = false
+}
+
+func (n *NotificationCenter) rerender() {
+	if n.isMounted {
+		vecty.Rerender(n)
+	}
+}
+
+func (n *NotificationCenter) Render() vecty.ComponentOrHTML {
+	var toasts vecty.List
+	for _, t := range n.toasts {
+		toasts = append(toasts, n.renderToast(t))
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("bottom", "20px"), vecty.Style("left", "50%"), vecty.Style("transform", "translateX(-50%)"), vecty.Style("display", "flex"), vecty.Style("flexDirection", "column"), vecty.Style("gap", "5px"), vecty.Style("maxWidth", "320px"), vecty.Style("zIndex", "2000")),
+		toasts,
+	)
+}
+
+func (n *NotificationCenter) renderToast(t Toast) vecty.ComponentOrHTML {
+	var actions vecty.List
+	for _, a := range t.Actions {
+		a := a
+		actions = append(actions, elem.Button(vecty.Text(a.Label), vecty.Markup(event.Click(func(e *vecty.Event) {
+			n.Dismiss(t.ID)
+			if a.Do != nil {
+				a.Do()
+			}
+		}))))
+	}
+	return elem.Div(
+		vecty.Markup(
+			vecty.Attribute("role", "status"),
+			vecty.Style("background", "rgba(0,0,0,0.85)"),
+			vecty.Style("color", "white"),
+			vecty.Style("padding", "8px 10px"),
+			vecty.Style("borderRadius", "3px"),
+			vecty.Style("borderLeft", "4px solid "+t.Severity.color()),
+		),
+		elem.Div(
+			vecty.Markup(vecty.Style("display", "flex"), vecty.Style("justifyContent", "space-between"), vecty.Style("gap", "10px")),
+			elem.Span(vecty.Text(t.Message)),
+			elem.Button(vecty.Text("×"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				n.Dismiss(t.ID)
+			}))),
+		),
+		vecty.If(len(actions) > 0, elem.Div(vecty.Markup(vecty.Style("marginTop", "5px")), actions)),
+	)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+const (
+	layerOverview = "overview"
+
+	overviewFetchDepth = 2   // below the paint zoom, fetch canonical tiles for at most this many levels
+	overviewMinAlpha   = 0.4 // keep sparse paint visible when it is blended down
+)
+
+// PaintOverviewResponse is the structure for the response from GET /api/paint/overview.
+// Cells are on a Grid x Grid raster covering the whole tile.
+type PaintOverviewResponse struct {
+	Zoom  int        `json:"zoom"`
+	TileX int        `json:"tile_x"`
+	TileY int        `json:"tile_y"`
+	Grid  int        `json:"grid"`
+	Cells []TileCell `json:"cells"`
+}
+
+// overviewTile is a downsampled RGBA raster of the paint under one low-zoom tile.
+type overviewTile struct {
+	grid  int
+	pix   []byte // nil if nothing under the tile is painted
+	local bool   // downsampled from paintCache rather than fetched from the server
+}
+
+// overviewGrid returns the raster size of an overview tile at zoom: one pixel per
+// canonical cell, capped at the tile size.
+func (m *IchthyoMapView) overviewGrid(zoom int) int {
+	grid := m.Config.GridSize << uint(m.Config.PaintZoom-zoom)
+	if grid > tileSize || grid <= 0 {
+		grid = tileSize
+	}
+	return grid
+}
+
+// paintOverviewLayer draws the paint pyramid below the paint zoom.
+type paintOverviewLayer struct{ m *IchthyoMapView }
+
+func (l *paintOverviewLayer) ID() string { return layerOverview }
+
+func (l *paintOverviewLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	if zoom >= l.m.Config.PaintZoom {
+		return
+	}
+	ov := l.m.overviewFor(zoom, tileX, tileY)
+	if ov == nil {
+		return
+	}
+	drawOverviewTile(ctx, ov, 0, 0, tileSize)
+}
+
+// drawOverviewTile blits an overview raster into ctx at (x, y) with the given size.
+func drawOverviewTile(ctx js.Value, ov *overviewTile, x, y, size float64) {
+	doc := js.Global().Get("document")
+	off := doc.Call("createElement", "canvas")
+	off.Set("width", ov.grid)
+	off.Set("height", ov.grid)
+	offCtx := off.Call("getContext", "2d")
+	img := offCtx.Call("createImageData", ov.grid, ov.grid)
+	data := js.Global().Get("Uint8Array").New(len(ov.pix))
+	js.CopyBytesToJS(data, ov.pix)
+	img.Get("data").Call("set", data)
+	offCtx.Call("putImageData", img, 0, 0)
+
+	ctx.Set("imageSmoothingEnabled", false)
+	ctx.Call("drawImage", off, x, y, size, size)
+}
+
+// overviewFor returns the overview of a low-zoom tile, or nil if it has no paint.
+// The server's pyramid is used when available; until it arrives, or if the server
+// has none, the tile is downsampled from the canonical tiles in paintCache.
+//
+// Only the last overviewFetchDepth levels below the paint zoom fetch the canonical
+// tiles they need, so further out the map depends on /api/paint/overview. Without
+// it those zooms show only paint that is already cached.
+func (m *IchthyoMapView) overviewFor(zoom, tileX, tileY int) *overviewTile {
+	key := geometry.TileCoord{Zoom: zoom, X: tileX, Y: tileY}.Wrap()
+	ov, ok := m.overviewCache[key]
+	if !ok {
+		if !m.overviewServerless {
+			m.fetchOverviewTile(key)
+		}
+		ov = m.localOverview(key)
+		m.overviewCache[key] = ov
+	}
+	if ov.pix == nil {
+		return nil
+	}
+	return ov
+}
+
+// localOverview builds the client side overview of a wrapped tile, fetching
+// the canonical tiles under it when it is close enough to the paint zoom.
+func (m *IchthyoMapView) localOverview(key geometry.TileCoord) *overviewTile {
+	depth := m.Config.PaintZoom - key.Zoom
+	if depth <= overviewFetchDepth {
+		n := 1 << uint(depth)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				cx, cy := key.X*n+x, key.Y*n+y
+				if _, ok := m.paintCache[geometry.TileCoord{Zoom: m.Config.PaintZoom, X: cx, Y: cy}]; !ok {
+					m.fetchPaintTile(m.Config.PaintZoom, cx, cy)
+				}
+			}
+		}
+	}
+	ov := m.downsamplePaint(key.Zoom, key.X, key.Y)
+	if ov == nil {
+		ov = &overviewTile{grid: m.overviewGrid(key.Zoom)}
+	}
+	ov.local = true
+	return ov
+}
+
+// invalidateOverview drops the cached overviews above a changed canonical tile
+// and reports whether there were any, i.e. whether they need redrawing.
+// Server overviews are kept unless refetch is set, e.g. after the player painted.
+func (m *IchthyoMapView) invalidateOverview(canonical geometry.TileCoord, refetch bool) (dropped bool) {
+	for zoom := canonical.Zoom - 1; zoom >= 0; zoom-- {
+		key := canonical.Ancestor(zoom)
+		if ov, ok := m.overviewCache[key]; ok && (ov.local || refetch) {
+			delete(m.overviewCache, key)
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// downsamplePaint blends the cached canonical cells under a tile into an overview raster.
+// Each pixel gets the average color of the painted cells under it, with an alpha
+// proportional to how much of it is painted.
+func (m *IchthyoMapView) downsamplePaint(zoom, tileX, tileY int) *overviewTile {
+	depth := uint(m.Config.PaintZoom - zoom)
+	grid := m.overviewGrid(zoom)
+	cellsPerSide := m.Config.GridSize << depth // canonical cells across this tile
+	per := cellsPerSide / grid                 // canonical cells per pixel side
+
+	type acc struct{ r, g, b, n int }
+	sums := make([]acc, grid*grid)
+	painted := false
+
+	for key, cells := range m.paintCache {
+		if key.Zoom != m.Config.PaintZoom || len(cells) == 0 {
+			continue
+		}
+		cx, cy := key.X, key.Y
+		if cx>>depth != tileX || cy>>depth != tileY {
+			continue
+		}
+		offX := (cx - tileX<<depth) * m.Config.GridSize
+		offY := (cy - tileY<<depth) * m.Config.GridSize
+		for _, cell := range cells {
+			r, g, b, ok := parseHexColor(cell.Color)
+			if !ok {
+				continue
+			}
+			px := (offX + cell.CellX) / per
+			py := (offY + cell.CellY) / per
+			a := &sums[py*grid+px]
+			a.r += int(r)
+			a.g += int(g)
+			a.b += int(b)
+			a.n++
+			painted = true
+		}
+	}
+	if !painted {
+		return nil
+	}
+
+	ov := &overviewTile{grid: grid, pix: make([]byte, grid*grid*4)}
+	for i, a := range sums {
+		if a.n == 0 {
+			continue
+		}
+		coverage := float64(a.n) / float64(per*per)
+		alpha := math.Max(coverage, overviewMinAlpha)
+		ov.pix[i*4] = byte(a.r / a.n)
+		ov.pix[i*4+1] = byte(a.g / a.n)
+		ov.pix[i*4+2] = byte(a.b / a.n)
+		ov.pix[i*4+3] = byte(math.Round(alpha * 255))
+	}
+	return ov
+}
+
+// fetchOverviewTile asks the server for a prebuilt overview tile, key must be wrapped.
+// If the endpoint is missing (404) the map stops asking and keeps using the client side pyramid.
+func (m *IchthyoMapView) fetchOverviewTile(key geometry.TileCoord) {
+	if !key.Valid() || m.overviewPending[key] {
+		return
+	}
+	m.overviewPending[key] = true
+
+	url := fmt.Sprintf("%s/api/paint/overview?zoom=%d&tile_x=%d&tile_y=%d", apiBaseURL, key.Zoom, key.X, key.Y)
+	getRequest(url, func(responseBody string) {
+		delete(m.overviewPending, key)
+		var data PaintOverviewResponse
+		if err := json.Unmarshal([]byte(responseBody), &data); err != nil || data.Grid <= 0 {
+			fmt.Println("Invalid paint overview, using the client side pyramid:", err)
+			return
+		}
+		ov := &overviewTile{grid: data.Grid, pix: make([]byte, data.Grid*data.Grid*4)}
+		for _, cell := range data.Cells {
+			r, g, b, ok := parseHexColor(cell.Color)
+			if !ok || cell.CellX < 0 || cell.CellY < 0 || cell.CellX >= data.Grid || cell.CellY >= data.Grid {
+				continue
+			}
+			i := (cell.CellY*data.Grid + cell.CellX) * 4
+			ov.pix[i], ov.pix[i+1], ov.pix[i+2], ov.pix[i+3] = r, g, b, 255
+		}
+		m.overviewCache[key] = ov
+		m.RedrawLayerArea(layerOverview, key.Zoom, key.X, key.Y)
+	}, func(errText string) {
+		delete(m.overviewPending, key)
+		// Only a missing endpoint turns the server pyramid off, other errors are retried
+		// the next time the tile's overview is invalidated.
+		if strings.HasPrefix(errText, "API Error (status 404)") {
+			m.overviewServerless = true
+			return
+		}
+		fmt.Println("Failed to fetch paint overview:", errText)
+	})
+}
+
+// parseHexColor parses "#RRGGBB" (or "#RGB") into its components.
+func parseHexColor(s string) (r, g, b uint8, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), true
+}
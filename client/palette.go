@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const maxRecentColors = 8
+
+// defaultPalette is used until (or if) the server's game config can be loaded.
+var defaultPalette = []string{
+	"#FF0000", "#00FF00", "#0000FF", "#FFFF00",
+	"#FF00FF", "#00FFFF", "#FFA500", "#800080",
+	"#008000", "#000080", "#800000", "#808000",
+	"#000000", "#FFFFFF", "#808080", "#C0C0C0",
+}
+
+// normalizeColor returns the color as upper-case "#RRGGBB".
+func normalizeColor(color string) (string, error) {
+	r, g, b, ok := parseHexColor(color)
+	if !ok {
+		return "", fmt.Errorf("invalid color %q", color)
+	}
+	return fmt.Sprintf("#%02X%02X%02X", r, g, b), nil
+}
+
+// nearestColor returns the palette color closest to color (squared RGB distance).
+func nearestColor(palette []string, color string) string {
+	r, g, b, ok := parseHexColor(color)
+	if !ok || len(palette) == 0 {
+		return ""
+	}
+	best, bestDist := "", -1
+	for _, p := range palette {
+		pr, pg, pb, ok := parseHexColor(p)
+		if !ok {
+			continue
+		}
+		dr, dg, db := int(r)-int(pr), int(g)-int(pg), int(b)-int(pb)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = p, d
+		}
+	}
+	return best
+}
+
+// ValidateColor normalizes color and checks that it is in the palette.
+func (m *IchthyoMapView) ValidateColor(color string) (string, error) {
+	c, err := normalizeColor(color)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range m.Config.Palette {
+		if p == c {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("color %s is not in the palette", c)
+}
+
+// SetSelectedColor changes the paint color if it is allowed.
+func (m *IchthyoMapView) SetSelectedColor(color string) error {
+	c, err := m.ValidateColor(color)
+	if err != nil {
+		return err
+	}
+	m.SelectedColor = c
+
+	recent := []string{c}
+	for _, r := range m.recentColors {
+		if r != c && len(recent) < maxRecentColors {
+			recent = append(recent, r)
+		}
+	}
+	m.recentColors = recent
+	if m.hoverCell != nil {
+		m.RedrawLayerTile(layerHover, m.hoverCell.Zoom, m.hoverCell.TileX, m.hoverCell.TileY)
+	}
+	return nil
+}
+
+// RecentColors returns the most recently chosen colors, newest first.
+func (m *IchthyoMapView) RecentColors() []string {
+	return m.recentColors
+}
+
+// normalizePalette returns the valid colors of colors, normalized.
+func normalizePalette(colors []string) []string {
+	var palette []string
+	for _, c := range colors {
+		if n, err := normalizeColor(c); err == nil {
+			palette = append(palette, n)
+		}
+	}
+	return palette
+}
+
+// paletteChanged updates what depends on the palette after Config.Palette is
+// replaced. If the selected color is no longer allowed, the first palette
+// color is selected.
+func (m *IchthyoMapView) paletteChanged() {
+	m.placingPreview = placingPreview{} // colors are snapped to the palette
+	m.selectionVersion++                // and so is the selection, see normalizedSelection
+	if _, err := m.ValidateColor(m.SelectedColor); err != nil {
+		m.SelectedColor = m.Config.Palette[0]
+	}
+	var recent []string
+	for _, r := range m.recentColors {
+		if _, err := m.ValidateColor(r); err == nil {
+			recent = append(recent, r)
+		}
+	}
+	m.recentColors = recent
+}
+
+// PalettePicker shows the allowed colors, the recently used ones and the
+// active color. Custom colors are snapped to the nearest palette color.
+type PalettePicker struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+}
+
+// NewPalettePicker creates a palette picker for mapView.
+func NewPalettePicker(mapView *IchthyoMapView) *PalettePicker {
+	return &PalettePicker{MapView: mapView}
+}
+
+func (p *PalettePicker) selectColor(color string) {
+	if err := p.MapView.SetSelectedColor(color); err != nil {
+		p.MapView.Notifications.Notify(SeverityError, err.Error())
+		return
+	}
+	vecty.Rerender(p)
+}
+
+func (p *PalettePicker) Render() vecty.ComponentOrHTML {
+	m := p.MapView
+	var swatches vecty.List
+	for _, c := range m.Config.Palette {
+		swatches = append(swatches, p.renderSwatch(c, 20))
+	}
+	var recent vecty.List
+	for _, c := range m.RecentColors() {
+		recent = append(recent, p.renderSwatch(c, 14))
+	}
+
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "60px"), vecty.Style("left", "20px"), vecty.Style("width", "112px"), vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px"), vecty.Style("borderRadius", "3px"), vecty.Style("zIndex", "1001")),
+		elem.Div(
+			vecty.Markup(vecty.Style("display", "flex"), vecty.Style("alignItems", "center"), vecty.Style("gap", "5px")),
+			elem.Span(vecty.Markup(vecty.Style("display", "inline-block"), vecty.Style("width", "20px"), vecty.Style("height", "20px"), vecty.Style("background", m.SelectedColor), vecty.Style("border", "2px solid white"))),
+			vecty.Text(m.SelectedColor),
+		),
+		elem.Div(vecty.Markup(vecty.Style("display", "flex"), vecty.Style("flexWrap", "wrap"), vecty.Style("marginTop", "5px")), swatches),
+		vecty.If(len(recent) > 0, elem.Div(vecty.Markup(vecty.Style("display", "flex"), vecty.Style("flexWrap", "wrap"), vecty.Style("marginTop", "5px")), recent)),
+		elem.Input(vecty.Markup(
+			vecty.Property("type", "color"),
+			vecty.Property("value", strings.ToLower(m.SelectedColor)),
+			vecty.Style("marginTop", "5px"),
+			vecty.Attribute("title", "Pick any color; it snaps to the nearest palette color"),
+			event.Change(func(e *vecty.Event) {
+				p.selectColor(nearestColor(m.Config.Palette, e.Target.Get("value").String()))
+			}),
+		)),
+	)
+}
+
+func (p *PalettePicker) renderSwatch(color string, size int) vecty.ComponentOrHTML {
+	border := "1px solid rgba(255,255,255,0.3)"
+	if color == p.MapView.SelectedColor {
+		border = "2px solid white"
+	}
+	return elem.Span(
+		vecty.Markup(
+			vecty.Style("display", "inline-block"),
+			vecty.Style("width", fmt.Sprintf("%dpx", size)),
+			vecty.Style("height", fmt.Sprintf("%dpx", size)),
+			vecty.Style("margin", "1px"),
+			vecty.Style("boxSizing", "border-box"),
+			vecty.Style("background", color),
+			vecty.Style("border", border),
+			vecty.Style("cursor", "pointer"),
+			vecty.Attribute("title", color),
+			event.Click(func(e *vecty.Event) {
+				p.selectColor(color)
+			}),
+		),
+	)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"syscall/js"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const (
+	layerPatternPreview = "pattern-preview"
+
+	patternVersion    = 1
+	maxPatternSide    = 1024 // cells, keeps parsing and the text format small
+	patternTextHeader = "ichthyo-pattern"
+	patternTextEmpty  = '.'
+	patternTextKeys   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// PatternCell is one cell of a pattern, relative to its top-left anchor.
+type PatternCell struct {
+	DX    int    `json:"dx"`
+	DY    int    `json:"dy"`
+	Color string `json:"color"`
+}
+
+// Pattern is a selection that can be saved and placed anywhere on the map.
+//
+// The compact text format is a header, one "key color" line per color and
+// one line of keys per row, '.' for empty cells:
+//
+//	ichthyo-pattern 3x2
+//	a #FF0000
+//	b #FFFFFF
+//	ab.
+//	.ba
+type Pattern struct {
+	Version int           `json:"version"`
+	Zoom    int           `json:"zoom,omitempty"` // zoom it was exported at, for reference
+	Width   int           `json:"width"`
+	Height  int           `json:"height"`
+	Cells   []PatternCell `json:"cells"`
+}
+
+// SelectionPattern returns the selection as a pattern anchored at the top-left
+// of its bounding box, or nil when nothing is selected.
+func (m *IchthyoMapView) SelectionPattern() *Pattern {
+	if len(m.SelectedCells) == 0 {
+		return nil
+	}
+	colors := make(map[Point]string)
+	minX, minY := math.MaxInt32, math.MaxInt32
+	maxX, maxY := math.MinInt32, math.MinInt32
+	for c, sel := range m.SelectedCells {
+		gx, gy := m.globalCell(c)
+		colors[Point{X: gx, Y: gy}] = sel.Payload.Color
+		minX, minY = int(math.Min(float64(minX), float64(gx))), int(math.Min(float64(minY), float64(gy)))
+		maxX, maxY = int(math.Max(float64(maxX), float64(gx))), int(math.Max(float64(maxY), float64(gy)))
+	}
+
+	p := &Pattern{Version: patternVersion, Zoom: m.Config.PaintZoom, Width: maxX - minX + 1, Height: maxY - minY + 1}
+	for pt, color := range colors {
+		p.Cells = append(p.Cells, PatternCell{DX: pt.X - minX, DY: pt.Y - minY, Color: color})
+	}
+	sort.Slice(p.Cells, func(i, j int) bool {
+		if p.Cells[i].DY != p.Cells[j].DY {
+			return p.Cells[i].DY < p.Cells[j].DY
+		}
+		return p.Cells[i].DX < p.Cells[j].DX
+	})
+	return p
+}
+
+// Text encodes p in the compact text format. It fails if p uses more colors
+// than there are keys or is larger than maxPatternSide.
+func (p *Pattern) Text() (string, error) {
+	if err := p.checkSize(); err != nil {
+		return "", err
+	}
+	keys := make(map[string]byte)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %dx%d\n", patternTextHeader, p.Width, p.Height)
+	for _, c := range p.Cells {
+		if _, ok := keys[c.Color]; ok {
+			continue
+		}
+		if len(keys) == len(patternTextKeys) {
+			return "", fmt.Errorf("pattern has more than %d colors", len(patternTextKeys))
+		}
+		k := patternTextKeys[len(keys)]
+		keys[c.Color] = k
+		fmt.Fprintf(&sb, "%c %s\n", k, c.Color)
+	}
+
+	rows := make([][]byte, p.Height)
+	for y := range rows {
+		rows[y] = []byte(strings.Repeat(string(patternTextEmpty), p.Width))
+	}
+	for _, c := range p.Cells {
+		rows[c.DY][c.DX] = keys[c.Color]
+	}
+	for _, row := range rows {
+		sb.Write(row)
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// checkSize reports an error if p is empty or larger than maxPatternSide.
+func (p *Pattern) checkSize() error {
+	if p.Width <= 0 || p.Height <= 0 || p.Width > maxPatternSide || p.Height > maxPatternSide {
+		return fmt.Errorf("pattern is %dx%d, it must be 1x1 to %dx%d", p.Width, p.Height, maxPatternSide, maxPatternSide)
+	}
+	return nil
+}
+
+// parsePattern reads a pattern in either the JSON or the text format.
+func parsePattern(data string) (*Pattern, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "{") {
+		var p Pattern
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return nil, fmt.Errorf("invalid pattern JSON: %v", err)
+		}
+		if err := p.checkSize(); err != nil {
+			return nil, err
+		}
+		for _, c := range p.Cells {
+			if c.DX < 0 || c.DY < 0 || c.DX >= p.Width || c.DY >= p.Height {
+				return nil, fmt.Errorf("pattern cell %d,%d is outside %dx%d", c.DX, c.DY, p.Width, p.Height)
+			}
+		}
+		return &p, nil
+	}
+	return parsePatternText(data)
+}
+
+func parsePatternText(data string) (*Pattern, error) {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	if !sc.Scan() {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	p := &Pattern{Version: patternVersion}
+	if _, err := fmt.Sscanf(sc.Text(), patternTextHeader+" %dx%d", &p.Width, &p.Height); err != nil {
+		return nil, fmt.Errorf("expected %q header: %v", patternTextHeader+" WxH", err)
+	}
+	if err := p.checkSize(); err != nil {
+		return nil, err
+	}
+
+	colors := make(map[byte]string)
+	y := 0
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// 凡例行は「キー 色」、それ以外は行データ
+		if len(line) > 2 && line[1] == ' ' {
+			colors[line[0]] = strings.TrimSpace(line[2:])
+			continue
+		}
+		if y >= p.Height {
+			return nil, fmt.Errorf("pattern has more than %d rows", p.Height)
+		}
+		if len(line) > p.Width {
+			return nil, fmt.Errorf("row %d is wider than %d", y+1, p.Width)
+		}
+		for x := 0; x < len(line); x++ {
+			if line[x] == patternTextEmpty {
+				continue
+			}
+			color, ok := colors[line[x]]
+			if !ok {
+				return nil, fmt.Errorf("row %d: unknown color key %q", y+1, line[x])
+			}
+			p.Cells = append(p.Cells, PatternCell{DX: x, DY: y, Color: color})
+		}
+		y++
+	}
+	return p, nil
+}
+
+// patternCellsAt returns the pattern's cells and colors with its top-left on anchor.
+// Colors outside the palette are snapped to the nearest palette color.
+func (m *IchthyoMapView) patternCellsAt(p *Pattern, anchor cellRef) ([]cellRef, []string) {
+	ax, ay := m.globalCell(anchor)
+	cells := make([]cellRef, 0, len(p.Cells))
+	colors := make([]string, 0, len(p.Cells))
+	for _, c := range p.Cells {
+		color, err := m.ValidateColor(c.Color)
+		if err != nil {
+			if color = nearestColor(m.Config.Palette, c.Color); color == "" {
+				continue
+			}
+		}
+		cells = append(cells, m.cellFromGlobal(anchor.Zoom, ax+c.DX, ay+c.DY))
+		colors = append(colors, color)
+	}
+	return cells, colors
+}
+
+// placingPreview caches patternCellsAt for the pattern being placed, so the
+// preview isn't recomputed for every tile on every hover.
+type placingPreview struct {
+	pattern *Pattern
+	anchor  cellRef
+	cells   []cellRef
+	colors  []string
+}
+
+// placingCellsAt returns patternCellsAt(m.placing, anchor), cached per anchor.
+func (m *IchthyoMapView) placingCellsAt(anchor cellRef) ([]cellRef, []string) {
+	pv := &m.placingPreview
+	if pv.pattern != m.placing || pv.anchor != anchor || pv.cells == nil {
+		cells, colors := m.patternCellsAt(m.placing, anchor)
+		*pv = placingPreview{pattern: m.placing, anchor: anchor, cells: cells, colors: colors}
+	}
+	return pv.cells, pv.colors
+}
+
+// BeginPlacing shows p under the cursor until a click places it or
+// CancelPlacing is called.
+func (m *IchthyoMapView) BeginPlacing(p *Pattern) {
+	m.placing = p
+	m.RedrawLayer(layerPatternPreview)
+}
+
+// CancelPlacing stops placing a pattern without changing the selection.
+func (m *IchthyoMapView) CancelPlacing() {
+	if m.placing == nil {
+		return
+	}
+	m.placing = nil
+	m.RedrawLayer(layerPatternPreview)
+	if m.OnSelectionChange != nil {
+		m.OnSelectionChange()
+	}
+}
+
+// Placing returns the pattern being placed, or nil.
+func (m *IchthyoMapView) Placing() *Pattern {
+	return m.placing
+}
+
+// placePattern merges the pattern into the selection with its top-left on anchor.
+func (m *IchthyoMapView) placePattern(anchor cellRef) {
+	cells, colors := m.placingCellsAt(anchor)
+	m.placing = nil
+	m.placingPreview = placingPreview{}
+	m.RedrawLayer(layerPatternPreview)
+	m.selectColoredCells("Paste", cells, colors)
+}
+
+// patternPreviewLayer shows the pattern being placed at the hovered cell.
+type patternPreviewLayer struct{ m *IchthyoMapView }
+
+func (l *patternPreviewLayer) ID() string { return layerPatternPreview }
+
+func (l *patternPreviewLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	m := l.m
+	if m.placing == nil || m.hoverCell == nil {
+		return
+	}
+	cells, colors := m.placingCellsAt(*m.hoverCell)
+	ctx.Set("globalAlpha", 0.6)
+	for i, c := range cells {
+		x, y, size, ok := m.cellRectInTile(c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY, zoom, tileX, tileY)
+		if !ok {
+			continue
+		}
+		ctx.Set("fillStyle", colors[i])
+		ctx.Call("fillRect", x, y, size, size)
+	}
+	ctx.Set("globalAlpha", 1)
+}
+
+// downloadText saves text as a file through a temporary link.
+func downloadText(filename, mimeType, text string) {
+	doc := js.Global().Get("document")
+	blob := js.Global().Get("Blob").New([]interface{}{text}, map[string]interface{}{"type": mimeType})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+	a := doc.Call("createElement", "a")
+	a.Set("href", url)
+	a.Set("download", filename)
+	doc.Get("body").Call("appendChild", a)
+	a.Call("click")
+	a.Call("remove")
+	js.Global().Get("URL").Call("revokeObjectURL", url)
+}
+
+// PatternPanel exports the selection as a pattern file and imports patterns
+// to place on the map.
+type PatternPanel struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	message string
+}
+
+// NewPatternPanel creates a pattern panel for mapView.
+func NewPatternPanel(mapView *IchthyoMapView) *PatternPanel {
+	return &PatternPanel{MapView: mapView}
+}
+
+func (p *PatternPanel) export(asText bool) {
+	pattern := p.MapView.SelectionPattern()
+	if pattern == nil {
+		p.message = "Nothing selected"
+		return
+	}
+	// 読み込めないファイルは書き出さない
+	if err := pattern.checkSize(); err != nil {
+		p.message = err.Error()
+		return
+	}
+	if asText {
+		text, err := pattern.Text()
+		if err != nil {
+			p.message = err.Error()
+			return
+		}
+		downloadText("pattern.txt", "text/plain", text)
+	} else {
+		data, err := json.MarshalIndent(pattern, "", "  ")
+		if err != nil {
+			p.message = err.Error()
+			return
+		}
+		downloadText("pattern.json", "application/json", string(data))
+	}
+	p.message = fmt.Sprintf("Exported %d cells", len(pattern.Cells))
+}
+
+func (p *PatternPanel) onFile(e *vecty.Event) {
+	files := e.Target.Get("files")
+	if files.Get("length").Int() == 0 {
+		return
+	}
+	readFile(files.Index(0), func(data []byte) {
+		pattern, err := parsePattern(string(data))
+		if err != nil {
+			p.message = err.Error()
+			vecty.Rerender(p)
+			return
+		}
+		p.MapView.BeginPlacing(pattern)
+		p.message = ""
+		vecty.Rerender(p)
+	}, func(errText string) {
+		p.message = "Failed to read file: " + errText
+		vecty.Rerender(p)
+	})
+	e.Target.Set("value", "") // 同じファイルをもう一度選べるように
+}
+
+func (p *PatternPanel) Render() vecty.ComponentOrHTML {
+	m := p.MapView
+	message := p.message
+	if pattern := m.Placing(); pattern != nil {
+		message = fmt.Sprintf("Click the map to place the %dx%d pattern (Esc cancels)", pattern.Width, pattern.Height)
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px")),
+		elem.Div(vecty.Markup(vecty.Style("fontWeight", "bold")), vecty.Text("Pattern")),
+		elem.Button(vecty.Text("Export JSON"), vecty.Markup(
+			vecty.Property("disabled", len(m.SelectedCells) == 0),
+			event.Click(func(e *vecty.Event) {
+				p.export(false)
+				vecty.Rerender(p)
+			}),
+		)),
+		elem.Button(vecty.Text("Export text"), vecty.Markup(
+			vecty.Property("disabled", len(m.SelectedCells) == 0),
+			event.Click(func(e *vecty.Event) {
+				p.export(true)
+				vecty.Rerender(p)
+			}),
+		)),
+		elem.Div(elem.Input(vecty.Markup(
+			vecty.Property("type", "file"),
+			vecty.Property("accept", ".json,.txt,application/json,text/plain"),
+			vecty.Attribute("title", "Import a pattern"),
+			event.Change(p.onFile),
+		))),
+		vecty.If(m.Placing() != nil, elem.Button(vecty.Text("Cancel"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			m.CancelPlacing()
+		})))),
+		vecty.If(message != "", elem.Div(vecty.Text(message))),
+	)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"strconv"
+
+	"ichthyo-cup-front/client/pixelart"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const (
+	defaultImportWidth = 32 // cells
+	previewScale       = 4  // preview pixels per cell
+)
+
+// ImportPanel converts an image into pixel art in the palette and adds it to
+// the selection at an anchor cell.
+type ImportPanel struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	open       bool
+	image      image.Image
+	width      int
+	height     int // 0 keeps the aspect ratio
+	dither     bool
+	grid       *pixelart.Grid
+	preview    string // data URL of the preview
+	anchorText string
+	message    string
+}
+
+// NewImportPanel creates an import panel for mapView.
+func NewImportPanel(mapView *IchthyoMapView) *ImportPanel {
+	return &ImportPanel{MapView: mapView, width: defaultImportWidth}
+}
+
+func (p *ImportPanel) onFile(e *vecty.Event) {
+	files := e.Target.Get("files")
+	if files.Get("length").Int() == 0 {
+		return
+	}
+	readFile(files.Index(0), func(data []byte) {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			p.message = "Failed to decode image: " + err.Error()
+			vecty.Rerender(p)
+			return
+		}
+		p.image = img
+		if p.anchorText == "" {
+			p.anchorText = formatTileCell(p.MapView.centerCell())
+		}
+		p.convert()
+		vecty.Rerender(p)
+	}, func(errText string) {
+		p.message = "Failed to read file: " + errText
+		vecty.Rerender(p)
+	})
+}
+
+// convert redoes the conversion with the current settings.
+func (p *ImportPanel) convert() {
+	p.grid, p.preview = nil, ""
+	if p.image == nil {
+		return
+	}
+	opts := pixelart.Options{Width: p.width, Height: p.height, Dither: p.dither}
+	// 量子化の前にサイズを確認する
+	w, h, err := opts.Size(p.image.Bounds())
+	if err != nil {
+		p.message = err.Error()
+		return
+	}
+	if w > maxTemplateSide || h > maxTemplateSide {
+		p.message = fmt.Sprintf("%dx%d cells is too large, at most %dx%d are supported", w, h, maxTemplateSide, maxTemplateSide)
+		return
+	}
+	palette, err := pixelart.ParsePalette(p.MapView.Config.Palette)
+	if err != nil {
+		p.message = err.Error()
+		return
+	}
+	g, err := pixelart.Convert(p.image, palette, opts)
+	if err != nil {
+		p.message = err.Error()
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, pixelart.Preview(g, previewScale)); err != nil {
+		p.message = "Failed to render preview: " + err.Error()
+		return
+	}
+	p.grid = g
+	p.preview = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	p.message = fmt.Sprintf("%dx%d cells", g.Width, g.Height)
+}
+
+// apply adds the converted cells to the selection with their top-left at the anchor.
+func (p *ImportPanel) apply() {
+	anchor, err := p.MapView.parseTileCell(p.anchorText)
+	if err != nil {
+		p.message = err.Error()
+		return
+	}
+	anchor = p.MapView.toCanonical(anchor)
+	ax, ay := p.MapView.globalCell(anchor)
+	var cells []cellRef
+	var colors []string
+	for y := 0; y < p.grid.Height; y++ {
+		for x := 0; x < p.grid.Width; x++ {
+			if color := p.grid.Hex(x, y); color != "" {
+				cells = append(cells, p.MapView.cellFromGlobal(anchor.Zoom, ax+x, ay+y))
+				colors = append(colors, color)
+			}
+		}
+	}
+	p.MapView.selectColoredCells("Import", cells, colors)
+	p.message = fmt.Sprintf("Added %d cells to the selection", len(cells))
+}
+
+func (p *ImportPanel) Render() vecty.ComponentOrHTML {
+	style := vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"))
+	if !p.open {
+		return elem.Div(style, elem.Button(vecty.Text("Import image"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			p.open = true
+			vecty.Rerender(p)
+		}))))
+	}
+
+	sizeInput := func(label string, value int, set func(int)) vecty.ComponentOrHTML {
+		text := ""
+		if value > 0 {
+			text = strconv.Itoa(value)
+		}
+		return elem.Label(
+			vecty.Text(label+" "),
+			elem.Input(vecty.Markup(
+				vecty.Property("type", "number"),
+				vecty.Property("min", "1"),
+				vecty.Property("max", strconv.Itoa(maxTemplateSide)),
+				vecty.Property("value", text),
+				vecty.Attribute("placeholder", "auto"),
+				vecty.Style("width", "50px"),
+				event.Change(func(e *vecty.Event) {
+					v, _ := strconv.Atoi(e.Target.Get("value").String())
+					set(v)
+					p.convert()
+					vecty.Rerender(p)
+				}),
+			)),
+		)
+	}
+
+	var result vecty.List
+	if p.grid != nil {
+		result = vecty.List{
+			elem.Div(elem.Image(vecty.Markup(
+				vecty.Property("src", p.preview),
+				vecty.Style("maxWidth", "240px"),
+				vecty.Style("maxHeight", "240px"),
+				vecty.Style("imageRendering", "pixelated"),
+				vecty.Style("background", "repeating-conic-gradient(#888 0 25%, #bbb 0 50%) 0 0 / 8px 8px"),
+			))),
+			elem.Div(
+				elem.Input(vecty.Markup(
+					vecty.Property("type", "text"),
+					vecty.Property("value", p.anchorText),
+					vecty.Attribute("title", "Top-left cell: zoom/tile_x/tile_y/cell_x/cell_y"),
+					event.Input(func(e *vecty.Event) {
+						p.anchorText = e.Target.Get("value").String()
+					}),
+				)),
+				elem.Button(vecty.Text("Center"), vecty.Markup(event.Click(func(e *vecty.Event) {
+					p.anchorText = formatTileCell(p.MapView.centerCell())
+					vecty.Rerender(p)
+				}))),
+			),
+			elem.Button(vecty.Text("Add to selection"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				p.apply()
+				vecty.Rerender(p)
+			}))),
+		}
+	}
+
+	var message vecty.ComponentOrHTML
+	if p.message != "" {
+		message = elem.Div(vecty.Text(p.message))
+	}
+
+	return elem.Div(
+		style,
+		elem.Div(
+			vecty.Markup(vecty.Style("display", "flex"), vecty.Style("justifyContent", "space-between")),
+			elem.Span(vecty.Markup(vecty.Style("fontWeight", "bold")), vecty.Text("Import image")),
+			elem.Button(vecty.Text("×"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				p.open = false
+				vecty.Rerender(p)
+			}))),
+		),
+		elem.Input(vecty.Markup(
+			vecty.Property("type", "file"),
+			vecty.Property("accept", "image/png,image/jpeg,image/gif"),
+			event.Change(p.onFile),
+		)),
+		elem.Div(
+			sizeInput("W", p.width, func(v int) { p.width = v }),
+			sizeInput(" H", p.height, func(v int) { p.height = v }),
+		),
+		elem.Label(
+			elem.Input(vecty.Markup(
+				vecty.Property("type", "checkbox"),
+				vecty.Property("checked", p.dither),
+				event.Change(func(e *vecty.Event) {
+					p.dither = e.Target.Get("checked").Bool()
+					p.convert()
+					vecty.Rerender(p)
+				}),
+			)),
+			vecty.Text(" Dither"),
+		),
+		result,
+		message,
+	)
+}
@@ -0,0 +1,247 @@
+// Package pixelart converts images into palette-indexed cell grids. It doesn't
+// depend on the browser so it can be used and tested natively.
+package pixelart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Transparent is the Grid index of cells that aren't painted.
+const Transparent = -1
+
+// alphaThreshold is the alpha below which a pixel is treated as transparent.
+const alphaThreshold = 0x80
+
+// Palette is the set of colors a Grid may use.
+type Palette []color.NRGBA
+
+// ParsePalette parses "#RRGGBB" (or "#RGB") colors into a palette.
+func ParsePalette(hex []string) (Palette, error) {
+	p := make(Palette, 0, len(hex))
+	for _, h := range hex {
+		c, err := ParseHex(h)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty palette")
+	}
+	return p, nil
+}
+
+// ParseHex parses a "#RRGGBB" or "#RGB" color.
+func ParseHex(s string) (color.NRGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Hex formats c as upper-case "#RRGGBB".
+func Hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// Nearest returns the index of the palette color closest to (r, g, b) by
+// squared RGB distance.
+func (p Palette) Nearest(r, g, b float64) int {
+	best, bestDist := 0, -1.0
+	for i, c := range p {
+		dr, dg, db := r-float64(c.R), g-float64(c.G), b-float64(c.B)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// Grid is an image converted to one palette index per cell, row-major.
+type Grid struct {
+	Width, Height int
+	Index         []int // palette index or Transparent
+	Palette       Palette
+}
+
+// At returns the palette index of cell (x, y).
+func (g *Grid) At(x, y int) int {
+	return g.Index[y*g.Width+x]
+}
+
+// Hex returns the color of cell (x, y) as "#RRGGBB", or "" if it is transparent.
+func (g *Grid) Hex(x, y int) string {
+	i := g.At(x, y)
+	if i == Transparent {
+		return ""
+	}
+	return Hex(g.Palette[i])
+}
+
+// Options control Convert.
+type Options struct {
+	Width, Height int  // target size in cells; 0 keeps the aspect ratio, both 0 keeps the image size
+	Dither        bool // Floyd–Steinberg error diffusion
+}
+
+// Size returns the size in cells that Convert makes of an image with bounds b.
+func (o Options) Size(b image.Rectangle) (w, h int, err error) {
+	if b.Empty() {
+		return 0, 0, fmt.Errorf("image is empty")
+	}
+	w, h = o.Width, o.Height
+	switch {
+	case w < 0 || h < 0:
+		return 0, 0, fmt.Errorf("invalid size %dx%d", w, h)
+	case w == 0 && h == 0:
+		w, h = b.Dx(), b.Dy()
+	case w == 0:
+		w = max(1, (b.Dx()*h+b.Dy()/2)/b.Dy())
+	case h == 0:
+		h = max(1, (b.Dy()*w+b.Dx()/2)/b.Dx())
+	}
+	return w, h, nil
+}
+
+// Convert resizes src to the requested size and quantizes it to p.
+func Convert(src image.Image, p Palette, opts Options) (*Grid, error) {
+	w, h, err := opts.Size(src.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	if b := src.Bounds(); w != b.Dx() || h != b.Dy() {
+		if src, err = Resize(src, w, h); err != nil {
+			return nil, err
+		}
+	}
+	return Quantize(src, p, opts.Dither), nil
+}
+
+// Resize scales src to w x h. Each target pixel is the alpha-weighted average
+// of the source pixels it covers, so downscaling doesn't alias.
+func Resize(src image.Image, w, h int) (*image.NRGBA, error) {
+	b := src.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", w, h)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			// premultiplied sums, as returned by RGBA()
+			var sr, sg, sb, sa, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, a := src.At(sx, sy).RGBA()
+					sr, sg, sb, sa = sr+uint64(r), sg+uint64(g), sb+uint64(bl), sa+uint64(a)
+					n++
+				}
+			}
+			avg := color.RGBA64{R: uint16(sr / n), G: uint16(sg / n), B: uint16(sb / n), A: uint16(sa / n)}
+			dst.SetNRGBA(x, y, color.NRGBAModel.Convert(avg).(color.NRGBA))
+		}
+	}
+	return dst, nil
+}
+
+// Quantize maps every pixel of src to its nearest palette color. Pixels with
+// alpha below 50% become Transparent. With dither the quantization error is
+// diffused to the neighboring pixels (Floyd–Steinberg).
+func Quantize(src image.Image, p Palette, dither bool) *Grid {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	g := &Grid{Width: w, Height: h, Index: make([]int, w*h), Palette: p}
+
+	// 誤差は今の行と次の行の分だけ持つ
+	cur := make([][3]float64, w+2)
+	next := make([][3]float64, w+2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			if c.A < alphaThreshold {
+				g.Index[y*w+x] = Transparent
+				continue
+			}
+			e := cur[x+1]
+			r := clamp(float64(c.R) + e[0])
+			gr := clamp(float64(c.G) + e[1])
+			bl := clamp(float64(c.B) + e[2])
+			i := p.Nearest(r, gr, bl)
+			g.Index[y*w+x] = i
+			if !dither {
+				continue
+			}
+			q := p[i]
+			er := [3]float64{r - float64(q.R), gr - float64(q.G), bl - float64(q.B)}
+			for k := 0; k < 3; k++ {
+				cur[x+2][k] += er[k] * 7 / 16
+				next[x][k] += er[k] * 3 / 16
+				next[x+1][k] += er[k] * 5 / 16
+				next[x+2][k] += er[k] * 1 / 16
+			}
+		}
+		cur, next = next, cur
+		for i := range next {
+			next[i] = [3]float64{}
+		}
+	}
+	return g
+}
+
+// Preview renders g with every cell scale x scale pixels.
+func Preview(g *Grid, scale int) *image.NRGBA {
+	if scale < 1 {
+		scale = 1
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, g.Width*scale, g.Height*scale))
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			i := g.At(x, y)
+			if i == Transparent {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetNRGBA(x*scale+px, y*scale+py, g.Palette[i])
+				}
+			}
+		}
+	}
+	return img
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
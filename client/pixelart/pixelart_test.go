@@ -0,0 +1,166 @@
+package pixelart
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var bw = Palette{{A: 0xff}, {R: 0xff, G: 0xff, B: 0xff, A: 0xff}}
+
+// fill returns a w x h image of one color.
+func fill(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestNearest(t *testing.T) {
+	p, err := ParsePalette([]string{"#000000", "#FF0000", "#00F", "#ffffff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		r, g, b float64
+		want    int
+	}{
+		{0, 0, 0, 0},
+		{40, 10, 10, 0},
+		{200, 30, 20, 1},
+		{10, 20, 220, 2},
+		{250, 250, 240, 3},
+	}
+	for _, tt := range tests {
+		if got := p.Nearest(tt.r, tt.g, tt.b); got != tt.want {
+			t.Errorf("Nearest(%v, %v, %v) = %d, want %d", tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 20, G: 20, B: 20, A: 0xff})
+	img.SetRGBA(1, 0, color.RGBA{R: 230, G: 230, B: 230, A: 0xff})
+	img.SetRGBA(2, 0, color.RGBA{R: 10, G: 10, B: 10, A: 0x10}) // mostly transparent
+
+	g := Quantize(img, bw, false)
+	want := []int{0, 1, Transparent}
+	for x, w := range want {
+		if got := g.At(x, 0); got != w {
+			t.Errorf("cell %d = %d, want %d", x, got, w)
+		}
+	}
+	if got := g.Hex(1, 0); got != "#FFFFFF" {
+		t.Errorf("Hex(1, 0) = %q, want #FFFFFF", got)
+	}
+	if got := g.Hex(2, 0); got != "" {
+		t.Errorf("Hex(2, 0) = %q for a transparent cell, want \"\"", got)
+	}
+}
+
+func TestQuantizeDither(t *testing.T) {
+	// 50% gray is between black and white: without dithering every cell
+	// snaps to the same color, with it they alternate to keep the average.
+	gray := fill(8, 8, color.RGBA{R: 128, G: 128, B: 128, A: 0xff})
+
+	plain := Quantize(gray, bw, false)
+	for i, v := range plain.Index {
+		if v != plain.Index[0] {
+			t.Fatalf("undithered cell %d = %d, want all %d", i, v, plain.Index[0])
+		}
+	}
+
+	dithered := Quantize(gray, bw, true)
+	white := 0
+	for _, v := range dithered.Index {
+		white += v
+	}
+	if n := len(dithered.Index); white < n*3/8 || white > n*5/8 {
+		t.Errorf("dithered gray has %d of %d white cells, want about half", white, n)
+	}
+}
+
+func TestResize(t *testing.T) {
+	// left half black, right half white
+	img := fill(4, 2, color.RGBA{A: 0xff})
+	for y := 0; y < 2; y++ {
+		for x := 2; x < 4; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+		}
+	}
+
+	small, err := Resize(img, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := small.NRGBAAt(0, 0); got != (color.NRGBA{A: 0xff}) {
+		t.Errorf("left pixel = %v, want black", got)
+	}
+	if got := small.NRGBAAt(1, 0); got != (color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Errorf("right pixel = %v, want white", got)
+	}
+
+	one, err := Resize(img, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := one.NRGBAAt(0, 0); got.R < 0x7f || got.R > 0x80 || got.A != 0xff {
+		t.Errorf("averaged pixel = %v, want mid gray", got)
+	}
+
+	big, err := Resize(img, 8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := big.NRGBAAt(7, 3); got.R != 0xff {
+		t.Errorf("upscaled corner = %v, want white", got)
+	}
+}
+
+func TestResizeInvalid(t *testing.T) {
+	if _, err := Resize(image.NewRGBA(image.Rect(0, 0, 0, 0)), 2, 2); err == nil {
+		t.Error("Resize of an empty image succeeded")
+	}
+	for _, size := range [][2]int{{0, 2}, {2, 0}, {-1, 2}} {
+		if _, err := Resize(fill(2, 2, color.RGBA{A: 0xff}), size[0], size[1]); err == nil {
+			t.Errorf("Resize to %dx%d succeeded", size[0], size[1])
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	img := fill(40, 20, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	tests := []struct {
+		opts         Options
+		wantW, wantH int
+	}{
+		{Options{}, 40, 20},
+		{Options{Width: 10}, 10, 5},
+		{Options{Height: 4}, 8, 4},
+		{Options{Width: 3, Height: 3}, 3, 3},
+	}
+	for _, tt := range tests {
+		g, err := Convert(img, bw, tt.opts)
+		if err != nil {
+			t.Errorf("Convert(%+v): %v", tt.opts, err)
+			continue
+		}
+		if g.Width != tt.wantW || g.Height != tt.wantH {
+			t.Errorf("Convert(%+v) is %dx%d, want %dx%d", tt.opts, g.Width, g.Height, tt.wantW, tt.wantH)
+		}
+		if g.At(g.Width-1, g.Height-1) != 1 {
+			t.Errorf("Convert(%+v) lost the white", tt.opts)
+		}
+	}
+
+	if _, err := Convert(image.NewRGBA(image.Rect(0, 0, 0, 5)), bw, Options{Width: 4}); err == nil {
+		t.Error("Convert of an empty image succeeded")
+	}
+	if _, err := Convert(img, bw, Options{Width: -1}); err == nil {
+		t.Error("Convert to a negative width succeeded")
+	}
+}
@@ -0,0 +1,125 @@
+// Package projection has the Web Mercator math of the map: lat/lng to world
+// pixels, and the Viewport that maps the screen onto the world. It doesn't use
+// syscall/js, so it works outside the browser too.
+package projection
+
+import (
+	"math"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+// TileSize is the side of a map tile in pixels.
+const TileSize = 256
+
+// LatLngToWorld converts lat/lng to world pixel coordinates at zoom, where the
+// world is 2^zoom tiles across.
+func LatLngToWorld(lat, lng, zoom float64) (x, y float64) {
+	latRad := lat * math.Pi / 180.0
+	n := math.Pow(2.0, zoom) * TileSize
+	x = (lng + 180.0) / 360.0 * n
+	y = (1.0 - math.Asinh(math.Tan(latRad))/math.Pi) / 2.0 * n
+	return x, y
+}
+
+// WorldToLatLng converts world pixel coordinates at zoom back to lat/lng.
+func WorldToLatLng(x, y, zoom float64) (lat, lng float64) {
+	n := math.Pow(2.0, zoom) * TileSize
+	lng = x/n*360.0 - 180.0
+	latRad := math.Atan(math.Sinh(math.Pi * (1.0 - 2.0*y/n)))
+	return latRad * 180.0 / math.Pi, lng
+}
+
+// Viewport is what the map shows: a Width x Height screen centered on
+// CenterLat/CenterLng at a fractional Zoom. Tiles are drawn at BaseZoom and
+// scaled down by Scale.
+type Viewport struct {
+	CenterLat, CenterLng float64
+	Zoom                 float64
+	Width, Height        float64 // screen size in pixels
+}
+
+// BaseZoom is the integer zoom of the tiles drawn for v. It isn't clamped:
+// Zoom must already be inside the map's zoom range, see clampZoom.
+func (v Viewport) BaseZoom() int {
+	return int(math.Ceil(v.Zoom))
+}
+
+// Scale is the size of a BaseZoom pixel on the screen, in (0.5, 1].
+func (v Viewport) Scale() float64 {
+	return math.Pow(2, v.Zoom-float64(v.BaseZoom()))
+}
+
+// Origin returns the world pixel at BaseZoom under the top-left corner of the screen.
+func (v Viewport) Origin() (x, y float64) {
+	scale := v.Scale()
+	cx, cy := LatLngToWorld(v.CenterLat, v.CenterLng, float64(v.BaseZoom()))
+	return cx - (v.Width/2)/scale, cy - (v.Height/2)/scale
+}
+
+// ScreenToWorld converts a screen position to world pixels at BaseZoom.
+func (v Viewport) ScreenToWorld(sx, sy float64) (x, y float64) {
+	scale := v.Scale()
+	ox, oy := v.Origin()
+	return sx/scale + ox, sy/scale + oy
+}
+
+// WorldToScreen is the inverse of ScreenToWorld.
+func (v Viewport) WorldToScreen(x, y float64) (sx, sy float64) {
+	scale := v.Scale()
+	ox, oy := v.Origin()
+	return (x - ox) * scale, (y - oy) * scale
+}
+
+// ScreenToLatLng returns the lat/lng under a screen position.
+func (v Viewport) ScreenToLatLng(sx, sy float64) (lat, lng float64) {
+	x, y := v.ScreenToWorld(sx, sy)
+	return WorldToLatLng(x, y, float64(v.BaseZoom()))
+}
+
+// LatLngToScreen returns the screen position of lat/lng.
+func (v Viewport) LatLngToScreen(lat, lng float64) (sx, sy float64) {
+	x, y := LatLngToWorld(lat, lng, float64(v.BaseZoom()))
+	return v.WorldToScreen(x, y)
+}
+
+// VisibleTile is a tile covering part of the screen. Left and Top are its
+// offset from Origin in BaseZoom pixels, before scaling by Scale.
+type VisibleTile struct {
+	geometry.TileCoord
+	Left, Top float64
+}
+
+// VisibleTiles returns the BaseZoom tiles covering the screen, row by row.
+// X is not wrapped, so tiles across the antimeridian keep their position.
+func (v Viewport) VisibleTiles() []VisibleTile {
+	zoom, scale := v.BaseZoom(), v.Scale()
+	ox, oy := v.Origin()
+	startX := int(math.Floor(ox / TileSize))
+	startY := int(math.Floor(oy / TileSize))
+	numX := int(math.Ceil(v.Width/(TileSize*scale))) + 1
+	numY := int(math.Ceil(v.Height/(TileSize*scale))) + 1
+
+	tiles := make([]VisibleTile, 0, (numX+1)*(numY+1))
+	for y := startY; y <= startY+numY; y++ {
+		for x := startX; x <= startX+numX; x++ {
+			tiles = append(tiles, VisibleTile{
+				TileCoord: geometry.TileCoord{Zoom: zoom, X: x, Y: y},
+				Left:      float64(x*TileSize) - ox,
+				Top:       float64(y*TileSize) - oy,
+			})
+		}
+	}
+	return tiles
+}
+
+// CellAt returns the cell under a screen position on the cell grid of zoom,
+// where every tile is gridSize x gridSize cells.
+func (v Viewport) CellAt(sx, sy float64, zoom, gridSize int) geometry.CellCoord {
+	x, y := v.ScreenToWorld(sx, sy)
+	f := math.Pow(2, float64(zoom-v.BaseZoom()))
+	cellPixelSize := float64(TileSize) / float64(gridSize)
+	gx := int(math.Floor(x * f / cellPixelSize))
+	gy := int(math.Floor(y * f / cellPixelSize))
+	return geometry.CellFromGlobal(zoom, gx, gy, gridSize)
+}
@@ -0,0 +1,145 @@
+package projection
+
+import (
+	"math"
+	"testing"
+
+	"ichthyo-cup-front/client/geometry"
+)
+
+const eps = 1e-6
+
+var zooms = []float64{0, 1, 3.4, 10, 15, 15.5, 18.75}
+
+var places = []struct{ lat, lng float64 }{
+	{0, 0},
+	{35.6762, 139.6503},
+	{-33.8688, 151.2093},
+	{51.5, -0.12},
+	{85, 179.9},
+	{-85, -179.9},
+	{84.9, -45},
+}
+
+func TestWorldRoundTrip(t *testing.T) {
+	for _, z := range zooms {
+		for _, p := range places {
+			x, y := LatLngToWorld(p.lat, p.lng, z)
+			lat, lng := WorldToLatLng(x, y, z)
+			if math.Abs(lat-p.lat) > eps || math.Abs(lng-p.lng) > eps {
+				t.Errorf("z%v: %v,%v -> %v,%v -> %v,%v", z, p.lat, p.lng, x, y, lat, lng)
+			}
+		}
+	}
+}
+
+func TestWorldEdges(t *testing.T) {
+	size := math.Pow(2, 3) * TileSize
+	if x, y := LatLngToWorld(0, 0, 3); math.Abs(x-size/2) > eps || math.Abs(y-size/2) > eps {
+		t.Errorf("0,0 at z3 = %v,%v, want the center %v", x, y, size/2)
+	}
+	if x, _ := LatLngToWorld(0, -180, 3); math.Abs(x) > eps {
+		t.Errorf("lng -180 at z3 = %v, want 0", x)
+	}
+	// Web Mercator ends at about ±85.0511°
+	if _, y := LatLngToWorld(85.0511287798, 0, 3); math.Abs(y) > 1e-3 {
+		t.Errorf("top of the world at z3 = %v, want 0", y)
+	}
+}
+
+// viewports returns viewports at every test zoom and place.
+func viewports() []Viewport {
+	var vs []Viewport
+	for _, z := range zooms {
+		for _, p := range places {
+			vs = append(vs, Viewport{CenterLat: p.lat, CenterLng: p.lng, Zoom: z, Width: 1280, Height: 720})
+		}
+	}
+	return vs
+}
+
+func TestScreenRoundTrip(t *testing.T) {
+	points := [][2]float64{{0, 0}, {640, 360}, {1279, 719}, {17.5, 600.25}}
+	for _, v := range viewports() {
+		if s := v.Scale(); s <= 0.5 || s > 1 {
+			t.Errorf("%+v: Scale() = %v, want (0.5, 1]", v, s)
+		}
+		// the center is in the middle of the screen
+		if sx, sy := v.LatLngToScreen(v.CenterLat, v.CenterLng); math.Abs(sx-v.Width/2) > eps || math.Abs(sy-v.Height/2) > eps {
+			t.Errorf("%+v: center at %v,%v", v, sx, sy)
+		}
+		for _, pt := range points {
+			lat, lng := v.ScreenToLatLng(pt[0], pt[1])
+			sx, sy := v.LatLngToScreen(lat, lng)
+			if math.Abs(sx-pt[0]) > 1e-4 || math.Abs(sy-pt[1]) > 1e-4 {
+				t.Errorf("%+v: %v -> %v,%v -> %v,%v", v, pt, lat, lng, sx, sy)
+			}
+		}
+	}
+}
+
+func TestVisibleTilesCoverScreen(t *testing.T) {
+	for _, v := range viewports() {
+		tiles := v.VisibleTiles()
+		visible := make(map[geometry.TileCoord]VisibleTile, len(tiles))
+		for _, tile := range tiles {
+			if tile.Zoom != v.BaseZoom() {
+				t.Fatalf("%+v: tile %v isn't at BaseZoom %d", v, tile.TileCoord, v.BaseZoom())
+			}
+			visible[tile.TileCoord] = tile
+		}
+
+		for sy := 0.0; sy <= v.Height; sy += v.Height / 8 {
+			for sx := 0.0; sx <= v.Width; sx += v.Width / 8 {
+				x, y := v.ScreenToWorld(sx, sy)
+				key := geometry.TileCoord{Zoom: v.BaseZoom(), X: int(math.Floor(x / TileSize)), Y: int(math.Floor(y / TileSize))}
+				tile, ok := visible[key]
+				if !ok {
+					t.Errorf("%+v: screen %v,%v is on tile %v, which isn't visible", v, sx, sy, key)
+					continue
+				}
+				// the tile is drawn where the point is
+				left := (tile.Left + x - float64(key.X*TileSize)) * v.Scale()
+				if math.Abs(left-sx) > 1e-6 {
+					t.Errorf("%+v: screen x %v drawn at %v", v, sx, left)
+				}
+				top := (tile.Top + y - float64(key.Y*TileSize)) * v.Scale()
+				if math.Abs(top-sy) > 1e-6 {
+					t.Errorf("%+v: screen y %v drawn at %v", v, sy, top)
+				}
+			}
+		}
+	}
+}
+
+// cellAtLatLng is the hit test the map used before Viewport: screen to
+// lat/lng, then lat/lng to the cell on the grid of zoom.
+func cellAtLatLng(v Viewport, sx, sy float64, zoom, gridSize int) geometry.CellCoord {
+	lat, lng := v.ScreenToLatLng(sx, sy)
+	x, y := LatLngToWorld(lat, lng, float64(zoom))
+	cellPixelSize := float64(TileSize) / float64(gridSize)
+	return geometry.CellFromGlobal(zoom, int(math.Floor(x/cellPixelSize)), int(math.Floor(y/cellPixelSize)), gridSize)
+}
+
+func TestCellAt(t *testing.T) {
+	for _, v := range viewports() {
+		// stay clear of cell edges, where rounding may go either way
+		for _, pt := range [][2]float64{{640, 360}, {100.3, 200.7}, {1200.1, 50.9}} {
+			for _, zoom := range []int{15, v.BaseZoom()} {
+				got := v.CellAt(pt[0], pt[1], zoom, 16)
+				want := cellAtLatLng(v, pt[0], pt[1], zoom, 16)
+				if got != want {
+					t.Errorf("%+v: CellAt(%v, z%d) = %v, want %v", v, pt, zoom, got, want)
+				}
+			}
+		}
+	}
+
+	// the cell under the center of a z15 view contains the center
+	v := Viewport{CenterLat: 35.6762, CenterLng: 139.6503, Zoom: 15, Width: 800, Height: 600}
+	c := v.CellAt(400, 300, 15, 16)
+	x, y := LatLngToWorld(v.CenterLat, v.CenterLng, 15)
+	if gx, gy := c.Global(16); gx != int(x/16) || gy != int(y/16) {
+		t.Errorf("center cell = %v (global %d,%d), want global %d,%d", c, gx, gy, int(x/16), int(y/16))
+	}
+}
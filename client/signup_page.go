@@ -13,9 +13,9 @@ import (
 
 type SignupPage struct {
 	vecty.Core
-	username string
-	password string
-	message  string
+	username      string
+	password      string
+	Notifications *NotificationCenter
 }
 
 func (s *SignupPage) Render() vecty.ComponentOrHTML {
@@ -47,7 +47,6 @@ func (s *SignupPage) Render() vecty.ComponentOrHTML {
 				)),
 			),
 			elem.Button(vecty.Text("Sign Up"), vecty.Markup(vecty.Property("type", "submit"))),
-			s.renderMessage(),
 		),
 		elem.Button(
 			vecty.Text("Back to Login"),
@@ -64,23 +63,14 @@ func (s *SignupPage) handleSignup(e *vecty.Event) {
 	authRequest(signupURL, s.username, s.password,
 		func(response string) {
 			// Signup successful, now try to login
-			s.message = "Signup successful! Please log in."
-			vecty.Rerender(s)
+			s.Notifications.Notify(SeveritySuccess, "Signup successful! Please log in.")
 
 			// NOTE: NextAuth credentials login is complex from an external client.
 			// For now, we just redirect to the login page to have the user log in manually.
 			js.Global().Get("location").Set("hash", "#/login")
 		},
 		func(err string) {
-			s.message = fmt.Sprintf("Signup failed: %s", err)
-			vecty.Rerender(s)
+			s.Notifications.Notify(SeverityError, fmt.Sprintf("Signup failed: %s", err))
 		},
 	)
-}
-
-func (s *SignupPage) renderMessage() vecty.ComponentOrHTML {
-	if s.message != "" {
-		return elem.Paragraph(vecty.Text(s.message))
-	}
-	return nil
 }
\ No newline at end of file
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/png"
+	"math"
+	"syscall/js"
+
+	"ichthyo-cup-front/client/geometry"
+	"ichthyo-cup-front/client/pixelart"
+
+	"github.com/hexops/vecty"
+	"github.com/hexops/vecty/elem"
+	"github.com/hexops/vecty/event"
+)
+
+const (
+	layerTemplate = "template"
+
+	maxTemplateSide        = 256 // cells
+	defaultTemplateOpacity = 0.5
+	maxAutoSelect          = maxFillCells // cells selected at most at once
+)
+
+// Template is a reference image quantized to the palette, one pixel per cell,
+// anchored with its top-left pixel on Anchor.
+type Template struct {
+	Name    string
+	Anchor  cellRef
+	Width   int
+	Height  int
+	Colors  []string // row-major palette colors, "" where the image is transparent
+	Opacity float64
+	Visible bool
+}
+
+// decodeTemplate decodes a PNG and maps every opaque pixel to the nearest palette color.
+func decodeTemplate(name string, data []byte, palette []string) (*Template, error) {
+	// 大きな画像を丸ごとデコードする前に、ヘッダーだけで大きさを確かめる
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode template: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("template image is empty")
+	}
+	if cfg.Width > maxTemplateSide || cfg.Height > maxTemplateSide {
+		return nil, fmt.Errorf("template is %dx%d, at most %dx%d cells are supported", cfg.Width, cfg.Height, maxTemplateSide, maxTemplateSide)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode template: %v", err)
+	}
+
+	p, err := pixelart.ParsePalette(palette)
+	if err != nil {
+		return nil, err
+	}
+	g := pixelart.Quantize(img, p, false)
+
+	t := &Template{
+		Name:    name,
+		Width:   g.Width,
+		Height:  g.Height,
+		Colors:  make([]string, g.Width*g.Height),
+		Opacity: defaultTemplateOpacity,
+		Visible: true,
+	}
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			t.Colors[y*t.Width+x] = g.Hex(x, y)
+		}
+	}
+	return t, nil
+}
+
+// cell returns the map cell under template pixel (x, y).
+// gridSize is the map's cells per tile side.
+func (t *Template) cell(x, y, gridSize int) cellRef {
+	gx, gy := t.Anchor.Global(gridSize)
+	return geometry.CellFromGlobal(t.Anchor.Zoom, gx+x, gy+y, gridSize)
+}
+
+// SetTemplate shows t on the template layer; nil removes it.
+func (m *IchthyoMapView) SetTemplate(t *Template) {
+	m.Template = t
+	m.RedrawLayer(layerTemplate)
+}
+
+// templateProgress is the last result of TemplateProgress and what it was computed from.
+type templateProgress struct {
+	template     *Template
+	anchor       cellRef
+	paintVersion int
+	matched      int
+	total        int
+}
+
+// TemplateProgress returns how many of the template's cells are already
+// painted in the template color, out of all its opaque cells. The result is
+// cached until the paint, the template or its anchor changes.
+func (m *IchthyoMapView) TemplateProgress() (matched, total int) {
+	t := m.Template
+	if t == nil {
+		return 0, 0
+	}
+	cached := m.templateProgress
+	if cached.template == t && cached.anchor == t.Anchor && cached.paintVersion == m.paintVersion {
+		return cached.matched, cached.total
+	}
+	for y := 0; y < t.Height; y++ {
+		for x := 0; x < t.Width; x++ {
+			want := t.Colors[y*t.Width+x]
+			if want == "" {
+				continue
+			}
+			total++
+			if painted, _ := m.paintedColor(t.cell(x, y, m.Config.GridSize)); painted == want {
+				matched++
+			}
+		}
+	}
+	m.templateProgress = templateProgress{template: t, anchor: t.Anchor, paintVersion: m.paintVersion, matched: matched, total: total}
+	return matched, total
+}
+
+// AutoSelectMismatches selects template cells that aren't painted in the
+// template color yet, in the template color, up to the remaining ink. Cells
+// whose tile isn't loaded are skipped, since their paint is unknown, and
+// counted in unloaded.
+func (m *IchthyoMapView) AutoSelectMismatches() (selected, unloaded int) {
+	t := m.Template
+	if t == nil {
+		return 0, 0
+	}
+	left := m.inkLeft() // -1 when unknown, then only maxAutoSelect caps it
+
+	var cells []cellRef
+	var colors []string
+scan:
+	for y := 0; y < t.Height; y++ {
+		for x := 0; x < t.Width; x++ {
+			want := t.Colors[y*t.Width+x]
+			if want == "" {
+				continue
+			}
+			c := t.cell(x, y, m.Config.GridSize)
+			painted, loaded := m.paintedColor(c)
+			if !loaded {
+				unloaded++
+				continue
+			}
+			if painted == want {
+				continue
+			}
+			sel, ok := m.SelectedCells[c]
+			if ok && sel.Payload.Color == want {
+				continue
+			}
+			if len(cells) >= maxAutoSelect {
+				break scan
+			}
+			// 選択済みのセルの色を変えてもインクは増えない
+			if !ok && left >= 0 {
+				cost := m.cellCost(c)
+				if cost > left {
+					break scan
+				}
+				left -= cost
+			}
+			cells = append(cells, c)
+			colors = append(colors, want)
+		}
+	}
+	m.selectColoredCells("Template", cells, colors)
+	return len(cells), unloaded
+}
+
+// centerCell returns the cell at the center of the screen.
+func (m *IchthyoMapView) centerCell() cellRef {
+	view := m.viewport()
+	return m.cellAt(view.Width/2, view.Height/2)
+}
+
+// templateLayer draws the template semi-transparently over the paint.
+type templateLayer struct{ m *IchthyoMapView }
+
+func (l *templateLayer) ID() string { return layerTemplate }
+
+func (l *templateLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	t := l.m.Template
+	if t == nil || !t.Visible {
+		return
+	}
+	az := t.Anchor.Zoom
+	grid := l.m.Config.GridSize
+	ax, ay := t.Anchor.Global(grid)
+
+	// このタイルが覆うテンプレートの範囲だけを見る
+	f := math.Pow(2, float64(az-zoom))
+	x0 := int(math.Floor(float64(tileX*grid)*f)) - ax
+	y0 := int(math.Floor(float64(tileY*grid)*f)) - ay
+	x1 := int(math.Ceil(float64((tileX+1)*grid)*f)) - ax
+	y1 := int(math.Ceil(float64((tileY+1)*grid)*f)) - ay
+
+	ctx.Set("globalAlpha", t.Opacity)
+	for y := int(math.Max(float64(y0), 0)); y < y1 && y < t.Height; y++ {
+		for x := int(math.Max(float64(x0), 0)); x < x1 && x < t.Width; x++ {
+			color := t.Colors[y*t.Width+x]
+			if color == "" {
+				continue
+			}
+			c := t.cell(x, y, grid)
+			px, py, size, ok := l.m.cellRectInTile(az, c.TileX, c.TileY, c.CellX, c.CellY, zoom, tileX, tileY)
+			if !ok {
+				continue
+			}
+			ctx.Set("fillStyle", color)
+			ctx.Call("fillRect", px, py, size, size)
+		}
+	}
+	ctx.Set("globalAlpha", 1)
+}
+
+// readFile reads a File from an <input type="file"> into memory.
+func readFile(file js.Value, onDone func([]byte), onError func(string)) {
+	var then, catch js.Func
+	then = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		buf := js.Global().Get("Uint8Array").New(args[0])
+		data := make([]byte, buf.Get("length").Int())
+		js.CopyBytesToGo(data, buf)
+		then.Release()
+		catch.Release()
+		onDone(data)
+		return nil
+	})
+	catch = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		then.Release()
+		catch.Release()
+		onError(args[0].Call("toString").String())
+		return nil
+	})
+	file.Call("arrayBuffer").Call("then", then).Call("catch", catch)
+}
+
+// TemplatePanel loads a template, anchors it and shows the painting progress.
+type TemplatePanel struct {
+	vecty.Core
+	MapView *IchthyoMapView `vecty:"prop"`
+
+	anchorText string
+	message    string
+}
+
+// NewTemplatePanel creates a template panel for mapView.
+func NewTemplatePanel(mapView *IchthyoMapView) *TemplatePanel {
+	return &TemplatePanel{MapView: mapView}
+}
+
+func (p *TemplatePanel) onFile(e *vecty.Event) {
+	files := e.Target.Get("files")
+	if files.Get("length").Int() == 0 {
+		return
+	}
+	file := files.Index(0)
+	readFile(file, func(data []byte) {
+		t, err := decodeTemplate(file.Get("name").String(), data, p.MapView.Config.Palette)
+		if err != nil {
+			p.message = err.Error()
+			vecty.Rerender(p)
+			return
+		}
+		t.Anchor = p.MapView.centerCell()
+		p.anchorText = formatTileCell(t.Anchor)
+		p.message = ""
+		p.MapView.SetTemplate(t)
+		vecty.Rerender(p)
+	}, func(errText string) {
+		p.message = "Failed to read file: " + errText
+		vecty.Rerender(p)
+	})
+}
+
+// setAnchor moves the template. Anchors are snapped to the canonical grid so
+// template pixels line up with paintable cells.
+func (p *TemplatePanel) setAnchor(c cellRef) {
+	c = p.MapView.toCanonical(c)
+	p.MapView.Template.Anchor = c
+	p.anchorText = formatTileCell(c)
+	p.message = ""
+	p.MapView.RedrawLayer(layerTemplate)
+	vecty.Rerender(p)
+}
+
+func (p *TemplatePanel) Render() vecty.ComponentOrHTML {
+	m := p.MapView
+	t := m.Template
+
+	var controls vecty.List
+	if t != nil {
+		matched, total := m.TemplateProgress()
+		percent := 0.0
+		if total > 0 {
+			percent = float64(matched) * 100 / float64(total)
+		}
+		controls = vecty.List{
+			elem.Div(vecty.Text(fmt.Sprintf("%s (%dx%d)", t.Name, t.Width, t.Height))),
+			elem.Form(
+				vecty.Markup(event.Submit(func(e *vecty.Event) {
+					c, err := m.parseTileCell(p.anchorText)
+					if err != nil {
+						p.message = err.Error()
+						vecty.Rerender(p)
+						return
+					}
+					p.setAnchor(c)
+				}).PreventDefault()),
+				elem.Input(vecty.Markup(
+					vecty.Property("type", "text"),
+					vecty.Property("value", p.anchorText),
+					vecty.Attribute("title", "Anchor: zoom/tile_x/tile_y/cell_x/cell_y"),
+					event.Input(func(e *vecty.Event) {
+						p.anchorText = e.Target.Get("value").String()
+					}),
+				)),
+				elem.Button(vecty.Text("Anchor"), vecty.Markup(vecty.Property("type", "submit"))),
+			),
+			elem.Button(vecty.Text("Anchor at center"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				p.setAnchor(m.centerCell())
+			}))),
+			elem.Div(
+				vecty.Text("Opacity "),
+				elem.Input(vecty.Markup(
+					vecty.Property("type", "range"),
+					vecty.Property("min", "0"),
+					vecty.Property("max", "1"),
+					vecty.Property("step", "0.05"),
+					vecty.Property("value", fmt.Sprint(t.Opacity)),
+					event.Input(func(e *vecty.Event) {
+						t.Opacity = e.Target.Get("valueAsNumber").Float()
+						m.RedrawLayer(layerTemplate)
+					}),
+				)),
+			),
+			elem.Div(vecty.Text(fmt.Sprintf("Progress: %d / %d (%.1f%%)", matched, total, percent))),
+			elem.Button(vecty.Text(map[bool]string{true: "Hide", false: "Show"}[t.Visible]), vecty.Markup(event.Click(func(e *vecty.Event) {
+				t.Visible = !t.Visible
+				m.RedrawLayer(layerTemplate)
+				vecty.Rerender(p)
+			}))),
+			elem.Button(vecty.Text("Auto-select mismatches"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				n, unloaded := m.AutoSelectMismatches()
+				p.message = fmt.Sprintf("Selected %d cells", n)
+				if unloaded > 0 {
+					p.message += fmt.Sprintf(", %d not loaded yet", unloaded)
+				}
+				vecty.Rerender(p)
+			}))),
+			elem.Button(vecty.Text("Remove"), vecty.Markup(event.Click(func(e *vecty.Event) {
+				m.SetTemplate(nil)
+				vecty.Rerender(p)
+			}))),
+		}
+	}
+
+	var message vecty.ComponentOrHTML
+	if p.message != "" {
+		message = elem.Div(vecty.Text(p.message))
+	}
+
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("bottom", "190px"), vecty.Style("left", "20px"), vecty.Style("width", "220px"), vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("zIndex", "1001")),
+		elem.Div(vecty.Markup(vecty.Style("fontWeight", "bold")), vecty.Text("Template")),
+		elem.Input(vecty.Markup(
+			vecty.Property("type", "file"),
+			vecty.Property("accept", "image/png"),
+			event.Change(p.onFile),
+		)),
+		controls,
+		message,
+	)
+}
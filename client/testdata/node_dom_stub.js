@@ -0,0 +1,6 @@
+// Lets the wasm tests of package client load vecty under node, which has no DOM.
+//
+//	NODE_OPTIONS=--require=./testdata/node_dom_stub.js GOOS=js GOARCH=wasm go test ./client
+//
+// (with $(go env GOROOT)/lib/wasm, or misc/wasm on older Go, on PATH)
+globalThis.document = globalThis.document || {};
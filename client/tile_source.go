@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TileSource describes where the base map tiles come from.
+type TileSource interface {
+	Name() string
+	URLTemplate() string // e.g. "/tiles/{z}/{x}/{y}.png", "{s}" is replaced by a subdomain
+	MinZoom() int
+	MaxZoom() int
+	Attribution() string
+	Subdomains() []string
+	TileSize() int
+}
+
+// XYZTileSource is a TileSource backed by a standard {z}/{x}/{y} URL template.
+type XYZTileSource struct {
+	Label      string
+	Template   string
+	Min        int
+	Max        int
+	Credit     string
+	Subs       []string
+	SourceSize int
+}
+
+func (s *XYZTileSource) Name() string         { return s.Label }
+func (s *XYZTileSource) URLTemplate() string  { return s.Template }
+func (s *XYZTileSource) MinZoom() int         { return s.Min }
+func (s *XYZTileSource) MaxZoom() int         { return s.Max }
+func (s *XYZTileSource) Attribution() string  { return s.Credit }
+func (s *XYZTileSource) Subdomains() []string { return s.Subs }
+
+func (s *XYZTileSource) TileSize() int {
+	if s.SourceSize <= 0 {
+		return tileSize
+	}
+	return s.SourceSize
+}
+
+var (
+	// OSMTileSource is the standard OpenStreetMap style through the nginx /tiles/ proxy (CORS回避).
+	OSMTileSource TileSource = &XYZTileSource{
+		Label:    "Standard",
+		Template: "/tiles/{z}/{x}/{y}.png",
+		Min:      0,
+		Max:      19,
+		Credit:   "© OpenStreetMap contributors",
+	}
+
+	// MutedTileSource is a light, low-contrast style so paint stands out.
+	MutedTileSource TileSource = &XYZTileSource{
+		Label:    "Muted",
+		Template: "https://{s}.basemaps.cartocdn.com/light_nolabels/{z}/{x}/{y}.png",
+		Min:      0,
+		Max:      20,
+		Credit:   "© OpenStreetMap contributors © CARTO",
+		Subs:     []string{"a", "b", "c", "d"},
+	}
+
+	// NoTileSource draws no base map at all, only paint.
+	NoTileSource TileSource = &XYZTileSource{
+		Label: "None",
+		Min:   defaultMinZoom,
+		Max:   defaultMaxZoom,
+	}
+)
+
+// BaseLayers lists the tile sources offered by the base-layer switcher.
+var BaseLayers = []TileSource{OSMTileSource, MutedTileSource, NoTileSource}
+
+// tileSourceURL fills in the source's URL template for the given tile.
+// It returns "" when the source has no template.
+func tileSourceURL(src TileSource, x, y, z int) string {
+	if src == nil || src.URLTemplate() == "" {
+		return ""
+	}
+	n := 1 << uint(z)
+	x = ((x % n) + n) % n // 経度方向は折り返す
+
+	url := src.URLTemplate()
+	if subs := src.Subdomains(); len(subs) > 0 {
+		i := (x + y) % len(subs)
+		if i < 0 {
+			i += len(subs)
+		}
+		url = strings.Replace(url, "{s}", subs[i], -1)
+	}
+	url = strings.Replace(url, "{z}", strconv.Itoa(z), -1)
+	url = strings.Replace(url, "{x}", strconv.Itoa(x), -1)
+	url = strings.Replace(url, "{y}", strconv.Itoa(y), -1)
+	return url
+}
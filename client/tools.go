@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"syscall/js"
+
+	"ichthyo-cup-front/client/geometry"
+
+	"github.com/hexops/vecty"
+)
+
+const (
+	layerToolPreview = "tool-preview"
+
+	maxFillCells = 4096 // flood fill stops after this many cells
+)
+
+// Tool is how clicks and drags on the map edit the selection.
+type Tool int
+
+const (
+	ToolSelect      Tool = iota // click toggles a cell, drag pans
+	ToolBrush                   // drag selects every cell crossed
+	ToolLine                    // drag selects a straight line
+	ToolRect                    // drag selects a filled rectangle
+	ToolRectOutline             // drag selects a rectangle outline
+	ToolFill                    // click selects the connected region of the clicked cell's color
+	ToolEyedropper              // click picks up a cell's color
+	ToolInspect                 // click shows who painted a cell and its history
+)
+
+// Tools lists the tools in the order the toolbar shows them.
+var Tools = []Tool{ToolSelect, ToolBrush, ToolLine, ToolRect, ToolRectOutline, ToolFill, ToolEyedropper, ToolInspect}
+
+func (t Tool) String() string {
+	switch t {
+	case ToolSelect:
+		return "Select"
+	case ToolBrush:
+		return "Brush"
+	case ToolLine:
+		return "Line"
+	case ToolRect:
+		return "Rect"
+	case ToolRectOutline:
+		return "Outline"
+	case ToolFill:
+		return "Fill"
+	case ToolEyedropper:
+		return "Eyedropper"
+	case ToolInspect:
+		return "Inspect"
+	}
+	return fmt.Sprintf("Tool(%d)", int(t))
+}
+
+// isStrokeTool reports whether dragging with t draws instead of panning.
+func (t Tool) isStrokeTool() bool {
+	return t == ToolBrush || t == ToolLine || t == ToolRect || t == ToolRectOutline
+}
+
+// globalCell returns a cell's position on the zoom level's global cell grid,
+// so tools can work across tile boundaries.
+func (m *IchthyoMapView) globalCell(c cellRef) (gx, gy int) {
+	return c.Global(m.Config.GridSize)
+}
+
+// cellFromGlobal is the inverse of globalCell.
+func (m *IchthyoMapView) cellFromGlobal(zoom, gx, gy int) cellRef {
+	return geometry.CellFromGlobal(zoom, gx, gy, m.Config.GridSize)
+}
+
+// lineCells returns the cells on the Bresenham line from a to b.
+func (m *IchthyoMapView) lineCells(a, b cellRef) []cellRef {
+	x0, y0 := m.globalCell(a)
+	x1, y1 := m.globalCell(b)
+	dx := int(math.Abs(float64(x1 - x0)))
+	dy := -int(math.Abs(float64(y1 - y0)))
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+
+	var cells []cellRef
+	for {
+		cells = append(cells, m.cellFromGlobal(a.Zoom, x0, y0))
+		if x0 == x1 && y0 == y1 {
+			return cells
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// rectCells returns the cells of the rectangle spanned by a and b.
+func (m *IchthyoMapView) rectCells(a, b cellRef, outline bool) []cellRef {
+	x0, y0 := m.globalCell(a)
+	x1, y1 := m.globalCell(b)
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	var cells []cellRef
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if outline && x != x0 && x != x1 && y != y0 && y != y1 {
+				continue
+			}
+			cells = append(cells, m.cellFromGlobal(a.Zoom, x, y))
+		}
+	}
+	return cells
+}
+
+// paintedColor returns the painted color of a cell and whether its tile is loaded.
+func (m *IchthyoMapView) paintedColor(c cellRef) (color string, loaded bool) {
+	cells, ok := m.paintCache[c.Tile().Wrap()]
+	if !ok {
+		return "", false
+	}
+	for _, cell := range cells {
+		if cell.CellX == c.CellX && cell.CellY == c.CellY {
+			n, _ := normalizeColor(cell.Color)
+			return n, true
+		}
+	}
+	return "", true
+}
+
+// fill selects the region of cells connected to start that share its painted
+// color, unpainted counting as a color, so an empty area enclosed by paint can
+// be filled.
+func (m *IchthyoMapView) fill(start cellRef) {
+	if _, loaded := m.paintedColor(start); !loaded {
+		m.Notifications.Notify(SeverityWarning, "This area hasn't loaded yet, try again in a moment.")
+		return
+	}
+	cells, truncated, unloaded := m.floodCells(start)
+	switch {
+	case truncated:
+		m.Notifications.Notify(SeverityWarning, fmt.Sprintf("The area is larger than %d cells, only part of it was filled.", maxFillCells))
+	case unloaded:
+		m.Notifications.Notify(SeverityInfo, "The fill stopped at tiles that haven't loaded yet.")
+	}
+	m.selectCells(cells)
+}
+
+// floodCells returns the region of cells connected to start that share its
+// painted color, whether it was cut off at maxFillCells, and whether it ran
+// into tiles that aren't loaded, which bound the region.
+func (m *IchthyoMapView) floodCells(start cellRef) (cells []cellRef, truncated, unloaded bool) {
+	target, ok := m.paintedColor(start)
+	if !ok {
+		return nil, false, true
+	}
+	sx, sy := m.globalCell(start)
+	seen := map[Point]bool{{X: sx, Y: sy}: true}
+	queue := []Point{{X: sx, Y: sy}}
+	for len(queue) > 0 && len(cells) < maxFillCells {
+		p := queue[0]
+		queue = queue[1:]
+		cells = append(cells, m.cellFromGlobal(start.Zoom, p.X, p.Y))
+		for _, n := range []Point{{X: p.X + 1, Y: p.Y}, {X: p.X - 1, Y: p.Y}, {X: p.X, Y: p.Y + 1}, {X: p.X, Y: p.Y - 1}} {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			color, loaded := m.paintedColor(m.cellFromGlobal(start.Zoom, n.X, n.Y))
+			if !loaded {
+				unloaded = true
+				continue
+			}
+			if color == target {
+				queue = append(queue, n)
+			}
+		}
+	}
+	return cells, len(queue) > 0, unloaded
+}
+
+// selectCells adds cells to SelectedCells with the selected color.
+func (m *IchthyoMapView) selectCells(cells []cellRef) {
+	color, err := m.ValidateColor(m.SelectedColor)
+	if err != nil {
+		m.Notifications.Notify(SeverityError, err.Error())
+		return
+	}
+	colors := make([]string, len(cells))
+	for i := range colors {
+		colors[i] = color
+	}
+	m.selectColoredCells(m.Tool.String(), cells, colors)
+}
+
+// selectColoredCells adds cells[i] with colors[i] to SelectedCells as one
+// undoable command and redraws the selection layer of the tiles they touch.
+// New cells beyond the ink balance are skipped.
+func (m *IchthyoMapView) selectColoredCells(name string, cells []cellRef, colors []string) {
+	touched := make(map[geometry.TileCoord]bool)
+	left, skipped := m.inkLeft(), 0
+	m.edit(name, func() {
+		for i, c := range cells {
+			c = m.toCanonical(c)
+			// 色の変更はインクが増えないので、新しいセルだけ数える
+			if _, selected := m.SelectedCells[c]; !selected && left >= 0 {
+				cost := m.cellCost(c)
+				if left < cost {
+					skipped++
+					continue
+				}
+				left -= cost
+			}
+			m.setSelected(c, &SelectedCellInfo{
+				TileX:   c.TileX,
+				TileY:   c.TileY,
+				Payload: PaintCellPayload{CellX: c.CellX, CellY: c.CellY, Color: colors[i]},
+			})
+			touched[c.Tile()] = true
+		}
+	})
+	for t := range touched {
+		m.RedrawLayerArea(layerSelection, t.Zoom, t.X, t.Y)
+	}
+	if len(cells) > 0 && m.OnSelectionChange != nil {
+		m.OnSelectionChange()
+	}
+	m.inkExceeded(skipped)
+}
+
+// pickColor makes the color of a cell the selected color. A pending selection
+// wins over the painted color, since it is what the user sees. With withOwner
+// the painter of the cell is reported through OnColorPicked too.
+func (m *IchthyoMapView) pickColor(c cellRef, withOwner bool) {
+	color := ""
+	if sel, ok := m.SelectedCells[c]; ok {
+		color = sel.Payload.Color
+	} else if painted, _ := m.paintedColor(c); painted != "" {
+		color = painted
+	}
+	if color == "" {
+		return
+	}
+	if err := m.SetSelectedColor(color); err != nil {
+		// パレット外の色は一番近い色にする
+		color = nearestColor(m.Config.Palette, color)
+		if err := m.SetSelectedColor(color); err != nil {
+			m.Notifications.Notify(SeverityError, err.Error())
+			return
+		}
+	}
+
+	owner := ""
+	if withOwner {
+		owner, _ = m.CellOwner(c)
+	}
+	if m.OnColorPicked != nil {
+		m.OnColorPicked(m.SelectedColor, owner)
+	}
+}
+
+// SetTool switches the active tool.
+func (m *IchthyoMapView) SetTool(t Tool) {
+	m.Tool = t
+	m.cancelStroke()
+}
+
+// beginStroke starts a drag with a stroke tool at the cell under the cursor.
+func (m *IchthyoMapView) beginStroke(e *vecty.Event) {
+	c := m.cellAt(e.Get("clientX").Float(), e.Get("clientY").Float())
+	m.isStroking = true
+	m.strokeStart = c
+	m.strokeLast = c
+	m.toolPreview = nil
+	m.beginEdit(m.Tool.String()) // the whole stroke is one undo step
+	if m.Tool == ToolBrush {
+		m.selectCells([]cellRef{c})
+		return
+	}
+	m.setToolPreview([]cellRef{c})
+}
+
+// continueStroke extends the stroke to the cell under the cursor.
+func (m *IchthyoMapView) continueStroke(e *vecty.Event) {
+	c := m.cellAt(e.Get("clientX").Float(), e.Get("clientY").Float())
+	if c == m.strokeLast {
+		return
+	}
+	switch m.Tool {
+	case ToolBrush:
+		m.selectCells(m.lineCells(m.strokeLast, c))
+	case ToolLine:
+		m.setToolPreview(m.lineCells(m.strokeStart, c))
+	case ToolRect, ToolRectOutline:
+		m.setToolPreview(m.rectCells(m.strokeStart, c, m.Tool == ToolRectOutline))
+	}
+	m.strokeLast = c
+}
+
+// endStroke writes the previewed shape into SelectedCells.
+func (m *IchthyoMapView) endStroke() {
+	if !m.isStroking {
+		return
+	}
+	cells := m.toolPreview
+	m.isStroking = false
+	m.setToolPreview(nil)
+	if m.Tool != ToolBrush {
+		m.selectCells(cells)
+	}
+	m.endEdit()
+}
+
+func (m *IchthyoMapView) cancelStroke() {
+	if !m.isStroking {
+		return
+	}
+	m.isStroking = false
+	m.setToolPreview(nil)
+	m.endEdit()
+}
+
+func (m *IchthyoMapView) setToolPreview(cells []cellRef) {
+	m.toolPreview = cells
+	m.RedrawLayer(layerToolPreview)
+}
+
+// toolPreviewLayer shows the line or rectangle being dragged.
+type toolPreviewLayer struct{ m *IchthyoMapView }
+
+func (l *toolPreviewLayer) ID() string { return layerToolPreview }
+
+func (l *toolPreviewLayer) DrawTile(ctx js.Value, zoom, tileX, tileY int) {
+	ctx.Set("globalAlpha", 0.6)
+	ctx.Set("fillStyle", l.m.SelectedColor)
+	for _, c := range l.m.toolPreview {
+		if x, y, size, ok := l.m.cellRectInTile(c.Zoom, c.TileX, c.TileY, c.CellX, c.CellY, zoom, tileX, tileY); ok {
+			ctx.Call("fillRect", x, y, size, size)
+		}
+	}
+	ctx.Set("globalAlpha", 1)
+}
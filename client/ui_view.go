@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"syscall/js"
+	"time"
 
 	"github.com/hexops/vecty"
 	"github.com/hexops/vecty/elem"
@@ -12,12 +14,109 @@ import (
 type UIView struct {
 	vecty.Core
 	MapView *IchthyoMapView `vecty:"prop"`
+
+	bookmarks *BookmarksPanel
+	palette   *PalettePicker
+	template  *TemplatePanel
+	imports   *ImportPanel
+	inspector *CellInspector
+	patterns  *PatternPanel
+
+	removeViewListener func()
+	saved              mapCallbacks // the map's handlers before Mount, restored on Unmount
+
+	isMounted bool
+	copied    string // last text copied from the coordinate readout
+	jumpText  string
+	jumpError string
+
+	locateError string
+	pickInfo    string // result of the last eyedropper pick
+	inkWarning  string
+}
+
+// mapCallbacks are the map's handlers UIView replaces while it is mounted.
+type mapCallbacks struct {
+	onCursorChange    func()
+	onSelectionChange func()
+	onInspect         func(c cellRef, clientX, clientY float64)
+	onInkChange       func()
+	onInkExceeded     func(skipped int)
+	onColorPicked     func(color, ownerID string)
+	onConfigChange    func()
 }
 
 // NewUIView creates a new UIView
 func NewUIView(mapView *IchthyoMapView) *UIView {
 	return &UIView{
-		MapView: mapView,
+		MapView:   mapView,
+		bookmarks: NewBookmarksPanel(mapView),
+		palette:   NewPalettePicker(mapView),
+		template:  NewTemplatePanel(mapView),
+		imports:   NewImportPanel(mapView),
+		inspector: NewCellInspector(mapView),
+		patterns:  NewPatternPanel(mapView),
+	}
+}
+
+// Mount starts following the map so the readouts stay current.
+func (u *UIView) Mount() {
+	u.isMounted = true
+	u.removeViewListener = u.MapView.AddViewListener(u.rerender)
+	m := u.MapView
+	u.saved = mapCallbacks{
+		onCursorChange:    m.OnCursorChange,
+		onSelectionChange: m.OnSelectionChange,
+		onInspect:         m.OnInspect,
+		onInkChange:       m.OnInkChange,
+		onInkExceeded:     m.OnInkExceeded,
+		onColorPicked:     m.OnColorPicked,
+		onConfigChange:    m.OnConfigChange,
+	}
+	u.MapView.OnCursorChange = u.rerender
+	onSelectionChange := u.saved.onSelectionChange
+	u.MapView.OnSelectionChange = func() {
+		if onSelectionChange != nil {
+			onSelectionChange()
+		}
+		u.rerender()
+	}
+	u.MapView.OnInspect = u.inspector.Open
+	u.MapView.OnInkChange = u.rerender
+	u.MapView.OnConfigChange = u.rerender
+	u.MapView.OnInkExceeded = func(skipped int) {
+		u.inkWarning = fmt.Sprintf("Not enough ink: %d cell(s) not selected", skipped)
+		u.rerender()
+	}
+	u.MapView.RefreshInk()
+	u.MapView.OnColorPicked = func(color, ownerID string) {
+		u.pickInfo = "Picked " + color
+		if ownerID != "" {
+			u.pickInfo += ", painted by " + ownerID
+		}
+		u.rerender()
+	}
+}
+
+func (u *UIView) Unmount() {
+	u.isMounted = false
+	if u.removeViewListener != nil {
+		u.removeViewListener()
+		u.removeViewListener = nil
+	}
+	m := u.MapView
+	m.OnCursorChange = u.saved.onCursorChange
+	m.OnSelectionChange = u.saved.onSelectionChange
+	m.OnInspect = u.saved.onInspect
+	m.OnInkChange = u.saved.onInkChange
+	m.OnInkExceeded = u.saved.onInkExceeded
+	m.OnColorPicked = u.saved.onColorPicked
+	m.OnConfigChange = u.saved.onConfigChange
+}
+
+func (u *UIView) rerender() {
+	if u.isMounted {
+		vecty.Rerender(u)
 	}
 }
 
@@ -25,7 +124,19 @@ func NewUIView(mapView *IchthyoMapView) *UIView {
 func (u *UIView) Render() vecty.ComponentOrHTML {
 	return elem.Div(
 		u.renderZoomControls(),
+		u.renderToolbar(),
+		u.renderBaseLayerSwitcher(),
+		u.bookmarks,
+		u.palette,
+		u.template,
+		elem.Div(
+			vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "60px"), vecty.Style("left", "150px"), vecty.Style("display", "flex"), vecty.Style("flexDirection", "column"), vecty.Style("alignItems", "flex-start"), vecty.Style("gap", "5px"), vecty.Style("zIndex", "1001")),
+			u.imports,
+			u.patterns,
+		),
+		u.inspector,
 		u.renderCoordinateInfo(),
+		u.renderAttribution(),
 	)
 }
 
@@ -33,19 +144,256 @@ func (u *UIView) renderZoomControls() vecty.ComponentOrHTML {
 	return elem.Div(
 		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "20px"), vecty.Style("left", "20px"), vecty.Style("zIndex", "1001")),
 		elem.Button(vecty.Text("+"), vecty.Markup(event.Click(func(e *vecty.Event) {
-			u.MapView.Zoom += 0.5
-			u.MapView.DrawMap()
+			u.MapView.ZoomBy(buttonZoomStep)
 		}))),
 		elem.Button(vecty.Text("-"), vecty.Markup(event.Click(func(e *vecty.Event) {
-			u.MapView.Zoom -= 0.5
-			u.MapView.DrawMap()
+			u.MapView.ZoomBy(-buttonZoomStep)
+		}))),
+		elem.Button(vecty.Text("Grid"), vecty.Markup(
+			vecty.MarkupIf(u.MapView.ShowGrid, vecty.Style("fontWeight", "bold")),
+			event.Click(func(e *vecty.Event) {
+				u.MapView.SetShowGrid(!u.MapView.ShowGrid)
+				vecty.Rerender(u)
+			}),
+		)),
+		elem.Button(vecty.Text("Locate me"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			u.locateError = ""
+			u.MapView.LocateMe(func(err *GeolocationError) {
+				u.locateError = err.Error()
+				vecty.Rerender(u)
+			})
+			vecty.Rerender(u)
+		}))),
+		u.renderLocateError(),
+	)
+}
+
+func (u *UIView) renderToolbar() vecty.ComponentOrHTML {
+	var buttons vecty.List
+	for _, t := range Tools {
+		t := t
+		buttons = append(buttons, elem.Button(
+			vecty.Text(t.String()),
+			vecty.Markup(
+				vecty.MarkupIf(t == u.MapView.Tool, vecty.Style("fontWeight", "bold")),
+				event.Click(func(e *vecty.Event) {
+					u.MapView.SetTool(t)
+					u.pickInfo = ""
+					if t != ToolInspect {
+						u.inspector.Close()
+					}
+					vecty.Rerender(u)
+				}),
+			),
+		))
+	}
+	var info vecty.ComponentOrHTML
+	if u.MapView.Tool == ToolEyedropper {
+		text := u.pickInfo
+		if text == "" {
+			text = "Click a cell to pick its color (Alt/Shift+click shows who painted it)"
+		}
+		info = elem.Div(
+			vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("marginTop", "5px")),
+			vecty.Text(text),
+		)
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "20px"), vecty.Style("left", "50%"), vecty.Style("transform", "translateX(-50%)"), vecty.Style("zIndex", "1001")),
+		buttons,
+		elem.Button(vecty.Text("Undo"), vecty.Markup(
+			vecty.Property("disabled", !u.MapView.CanUndo()),
+			vecty.Attribute("title", "Ctrl+Z"),
+			event.Click(func(e *vecty.Event) {
+				u.MapView.Undo()
+			}),
+		)),
+		elem.Button(vecty.Text("Redo"), vecty.Markup(
+			vecty.Property("disabled", !u.MapView.CanRedo()),
+			vecty.Attribute("title", "Ctrl+Shift+Z"),
+			event.Click(func(e *vecty.Event) {
+				u.MapView.Redo()
+			}),
+		)),
+		elem.Button(vecty.Text("Clear"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			u.inkWarning = ""
+			u.MapView.ClearSelection()
 		}))),
+		elem.Button(vecty.Text("Paint"), vecty.Markup(
+			vecty.Property("disabled", len(u.MapView.SelectedCells) == 0 || u.MapView.OverBudget() || u.MapView.OverCommitLimit()),
+			event.Click(func(e *vecty.Event) {
+				u.inkWarning = ""
+				u.MapView.CommitSelection()
+			}),
+		)),
+		u.renderInk(),
+		u.renderDraftPrompt(),
+		info,
+	)
+}
+
+// renderDraftPrompt asks whether to restore a saved selection the map has
+// changed under.
+func (u *UIView) renderDraftPrompt() vecty.ComponentOrHTML {
+	draft, changed := u.MapView.PendingDraft()
+	if draft == nil || changed == 0 {
+		return nil
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("marginTop", "5px")),
+		vecty.Text(fmt.Sprintf("Restore draft of %d cells from %s? %d of them were painted over since.", len(draft.Cells), formatPaintedAt(draft.SavedAt), changed)),
+		elem.Button(vecty.Text("Restore"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			u.MapView.RestoreDraft()
+			u.MapView.FlyTo(draft.CenterLat, draft.CenterLng, float64(draft.Zoom), time.Second)
+		}))),
+		elem.Button(vecty.Text("Discard"), vecty.Markup(event.Click(func(e *vecty.Event) {
+			u.MapView.DiscardDraft()
+		}))),
+	)
+}
+
+// renderInk shows what the selection costs against the ink balance.
+func (u *UIView) renderInk() vecty.ComponentOrHTML {
+	m := u.MapView
+	balance := "?"
+	if m.InkBalance >= 0 {
+		balance = fmt.Sprint(m.InkBalance)
+	}
+	color := "white"
+	if m.OverBudget() {
+		color = "#ff8080"
+	}
+	warning := u.inkWarning
+	if warning == "" && m.OverBudget() {
+		warning = "The selection needs more ink than you have"
+	}
+	if warning == "" && m.OverCommitLimit() {
+		warning = fmt.Sprintf("At most %d cells can be painted at once", m.Config.MaxCellsPerCommit)
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", color), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("marginTop", "5px")),
+		vecty.Text(fmt.Sprintf("Selected: %d cells, %d ink / Ink: %s", len(m.normalizedSelection()), m.SelectionCost(), balance)),
+		vecty.If(warning != "", elem.Div(vecty.Markup(vecty.Style("color", "#ff8080")), vecty.Text(warning))),
+	)
+}
+
+func (u *UIView) renderLocateError() vecty.ComponentOrHTML {
+	if u.locateError == "" {
+		return nil
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "#ff8080"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("marginTop", "5px")),
+		vecty.Text(u.locateError),
 	)
 }
 
 func (u *UIView) renderCoordinateInfo() vecty.ComponentOrHTML {
+	m := u.MapView
+	rows := vecty.List{
+		elem.Div(vecty.Text(fmt.Sprintf("Lat: %.4f, Lng: %.4f, Zoom: %.2f", m.CenterLat, m.CenterLng, m.Zoom))),
+	}
+	if lat, lng, cell, ok := m.CursorPosition(); ok {
+		owner := "-"
+		if id, painted := m.CellOwner(cell); painted {
+			owner = id
+		}
+		rows = append(rows,
+			elem.Div(vecty.Text(fmt.Sprintf("Cursor (zoom %d): tile_x %d, tile_y %d, cell_x %d, cell_y %d", cell.Zoom, cell.TileX, cell.TileY, cell.CellX, cell.CellY))),
+			elem.Div(vecty.Text("Owner: "+owner)),
+			u.renderCopyRow(formatTileCell(cell)),
+			u.renderCopyRow(formatDecimal(lat, lng)),
+			u.renderCopyRow(formatDMS(lat, lng)),
+			u.renderCopyRow(encodeGeohash(lat, lng, 9)),
+		)
+	}
 	return elem.Div(
 		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("bottom", "20px"), vecty.Style("right", "20px"), vecty.Style("background", "rgba(0,0,0,0.7)"), vecty.Style("color", "white"), vecty.Style("padding", "5px 10px"), vecty.Style("borderRadius", "3px"), vecty.Style("zIndex", "1001")),
-		vecty.Text(fmt.Sprintf("Lat: %.4f, Lng: %.4f, Zoom: %.2f", u.MapView.CenterLat, u.MapView.CenterLng, u.MapView.Zoom)),
+		rows,
+		u.renderJumpInput(),
+	)
+}
+
+// renderCopyRow renders a position that is copied to the clipboard when clicked.
+func (u *UIView) renderCopyRow(text string) vecty.ComponentOrHTML {
+	label := text
+	if text == u.copied {
+		label += " (copied)"
+	}
+	return elem.Div(
+		vecty.Markup(
+			vecty.Style("cursor", "copy"),
+			vecty.Attribute("title", "Click to copy"),
+			event.Click(func(e *vecty.Event) {
+				js.Global().Get("navigator").Get("clipboard").Call("writeText", text)
+				u.copied = text
+				vecty.Rerender(u)
+			}),
+		),
+		vecty.Text(label),
+	)
+}
+
+// renderJumpInput accepts any format shown in the readout and flies there.
+func (u *UIView) renderJumpInput() vecty.ComponentOrHTML {
+	var errText vecty.ComponentOrHTML
+	if u.jumpError != "" {
+		errText = elem.Div(vecty.Markup(vecty.Style("color", "#ff8080")), vecty.Text(u.jumpError))
+	}
+	return elem.Form(
+		vecty.Markup(event.Submit(func(e *vecty.Event) {
+			lat, lng, zoom, err := u.MapView.parsePosition(u.jumpText)
+			if err != nil {
+				u.jumpError = err.Error()
+				vecty.Rerender(u)
+				return
+			}
+			if zoom == 0 {
+				zoom = u.MapView.Zoom
+			}
+			u.jumpError = ""
+			u.MapView.FlyTo(lat, lng, zoom, time.Second)
+		}).PreventDefault()),
+		elem.Input(vecty.Markup(
+			vecty.Property("type", "text"),
+			vecty.Property("placeholder", "Jump to lat,lng / DMS / geohash / z/x/y/cx/cy"),
+			vecty.Property("value", u.jumpText),
+			event.Input(func(e *vecty.Event) {
+				u.jumpText = e.Target.Get("value").String()
+			}),
+		)),
+		errText,
+	)
+}
+
+func (u *UIView) renderBaseLayerSwitcher() vecty.ComponentOrHTML {
+	var buttons vecty.List
+	for _, src := range BaseLayers {
+		src := src
+		buttons = append(buttons, elem.Button(
+			vecty.Text(src.Name()),
+			vecty.Markup(
+				vecty.MarkupIf(src == u.MapView.TileSource, vecty.Style("fontWeight", "bold")),
+				event.Click(func(e *vecty.Event) {
+					u.MapView.SetTileSource(src)
+					vecty.Rerender(u)
+				}),
+			),
+		))
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("top", "20px"), vecty.Style("right", "20px"), vecty.Style("zIndex", "1001")),
+		buttons,
+	)
+}
+
+// renderAttribution shows the tile source's required attribution in the corner.
+func (u *UIView) renderAttribution() vecty.ComponentOrHTML {
+	src := u.MapView.TileSource
+	if src == nil || src.Attribution() == "" {
+		return nil
+	}
+	return elem.Div(
+		vecty.Markup(vecty.Style("position", "fixed"), vecty.Style("bottom", "0"), vecty.Style("right", "0"), vecty.Style("background", "rgba(255,255,255,0.8)"), vecty.Style("color", "#333"), vecty.Style("fontSize", "11px"), vecty.Style("padding", "0 5px"), vecty.Style("zIndex", "1001")),
+		vecty.Text(src.Attribution()),
 	)
 }